@@ -0,0 +1,77 @@
+package apperror
+
+import (
+	"errors"
+	"time"
+)
+
+// Kind classifies an Error so the transport layer can pick a response status
+// without knowing which layer produced it.
+type Kind int
+
+const (
+	KindNotFound Kind = iota + 1
+	KindConflict
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindPreconditionFailed
+	KindTooManyRequests
+)
+
+type Error struct {
+	Kind   Kind
+	Detail string
+	// Fields maps a request field name to what is wrong with it. Only set for KindValidation.
+	Fields map[string]string
+	// Extensions carries extra machine-readable members, such as the ID of a conflicting resource.
+	Extensions map[string]interface{}
+	// RetryAfter is how long the client should wait before trying again. Only set for KindTooManyRequests.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func NotFound(detail string) error {
+	return &Error{Kind: KindNotFound, Detail: detail}
+}
+
+func Conflict(detail string) error {
+	return &Error{Kind: KindConflict, Detail: detail}
+}
+
+// ConflictWith is Conflict with extension members describing what it conflicts with.
+func ConflictWith(detail string, extensions map[string]interface{}) error {
+	return &Error{Kind: KindConflict, Detail: detail, Extensions: extensions}
+}
+
+func Validation(detail string, fields map[string]string) error {
+	return &Error{Kind: KindValidation, Detail: detail, Fields: fields}
+}
+
+func Unauthorized(detail string) error {
+	return &Error{Kind: KindUnauthorized, Detail: detail}
+}
+
+func Forbidden(detail string) error {
+	return &Error{Kind: KindForbidden, Detail: detail}
+}
+
+func PreconditionFailed(detail string) error {
+	return &Error{Kind: KindPreconditionFailed, Detail: detail}
+}
+
+func TooManyRequests(detail string, retryAfter time.Duration) error {
+	return &Error{Kind: KindTooManyRequests, Detail: detail, RetryAfter: retryAfter}
+}
+
+// KindOf returns the Kind of the first *Error in err's chain, or 0 if there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return 0
+}
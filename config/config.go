@@ -0,0 +1,306 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole application configuration. Each field is filled from,
+// in increasing order of precedence: its default tag, the YAML file named by
+// CONFIG_FILE, the .env file (or ENV_FILE), and the process environment.
+type Config struct {
+	Env       string          `yaml:"env" env:"GO_ENV" default:"production"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Health    HealthConfig    `yaml:"health"`
+	Log       LogConfig       `yaml:"log"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Mail      MailConfig      `yaml:"mail"`
+	Password  PasswordConfig  `yaml:"password"`
+	Task      TaskConfig      `yaml:"task"`
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" env:"SERVER_ADDR" default:":8080"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"5s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"15s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"60s"`
+	// ShutdownDelay is how long to keep serving after readiness turns false,
+	// giving load balancers time to stop routing new requests here.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" default:"0s"`
+	// ShutdownTimeout bounds how long in-flight requests may take to drain.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" default:"30s"`
+	// OpsAddr is where /metrics is served, apart from the API so it isn't
+	// public. Widen it only on a network the scraper alone can reach.
+	OpsAddr string `yaml:"ops_addr" env:"SERVER_OPS_ADDR" default:"127.0.0.1:9090"`
+}
+
+type DatabaseConfig struct {
+	User     string `yaml:"user" env:"POSTGRES_USER" required:"true"`
+	Password Secret `yaml:"password" env:"POSTGRES_PW" required:"true"`
+	Host     string `yaml:"host" env:"POSTGRES_HOST" required:"true"`
+	Port     string `yaml:"port" env:"POSTGRES_PORT" default:"5432"`
+	Name     string `yaml:"name" env:"POSTGRES_DB" required:"true"`
+	// RequestTimeout bounds the database work done on behalf of one HTTP
+	// request. Zero disables the limit.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"DB_REQUEST_TIMEOUT" default:"5s"`
+}
+
+type AuthConfig struct {
+	Secret          Secret        `yaml:"secret" env:"SECRET" required:"true"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" default:"720h"`
+	// Each account may attempt LoginBurst logins at once, regaining one
+	// attempt every LoginInterval.
+	LoginBurst    int           `yaml:"login_burst" env:"LOGIN_BURST" default:"5"`
+	LoginInterval time.Duration `yaml:"login_interval" env:"LOGIN_INTERVAL" default:"1m"`
+	// After LockoutThreshold consecutive failures the account is locked for
+	// LockoutDuration, doubling with every further failure up to
+	// MaxLockoutDuration. Failures older than FailureWindow are forgotten.
+	LockoutThreshold   int           `yaml:"lockout_threshold" env:"LOCKOUT_THRESHOLD" default:"5"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration" env:"LOCKOUT_DURATION" default:"1m"`
+	MaxLockoutDuration time.Duration `yaml:"max_lockout_duration" env:"MAX_LOCKOUT_DURATION" default:"1h"`
+	FailureWindow      time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW" default:"24h"`
+	// VerificationURL is the link mailed to new users, with ?token= appended.
+	VerificationURL      string        `yaml:"verification_url" env:"VERIFICATION_URL" default:"http://localhost:8080/verify"`
+	VerificationTokenTTL time.Duration `yaml:"verification_token_ttl" env:"VERIFICATION_TOKEN_TTL" default:"24h"`
+	// VerificationResendInterval is the minimum time between resent emails.
+	VerificationResendInterval time.Duration `yaml:"verification_resend_interval" env:"VERIFICATION_RESEND_INTERVAL" default:"1m"`
+	// PasswordResetURL is the frontend page mailed for resets, with ?token= appended.
+	PasswordResetURL      string        `yaml:"password_reset_url" env:"PASSWORD_RESET_URL" default:"http://localhost:3000/password/reset"`
+	PasswordResetTokenTTL time.Duration `yaml:"password_reset_token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" default:"1h"`
+	// PasswordResetInterval is the minimum time between reset emails to one address.
+	PasswordResetInterval time.Duration `yaml:"password_reset_interval" env:"PASSWORD_RESET_INTERVAL" default:"1m"`
+	// MFAIssuer names the service in authenticator apps.
+	MFAIssuer string `yaml:"mfa_issuer" env:"MFA_ISSUER" default:"go-rest-api"`
+	// MFAChallengeTTL is how long after the password step the second factor may be given.
+	MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL" default:"5m"`
+}
+
+type HTTPConfig struct {
+	FrontendURL string `yaml:"frontend_url" env:"FE_URL"`
+	APIDomain   string `yaml:"api_domain" env:"API_DOMAIN"`
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For. Only enable
+	// it behind a proxy that sets the header, or clients can spoof their IP.
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS" default:"false"`
+}
+
+type HealthConfig struct {
+	CheckTimeout time.Duration `yaml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+	// SlowQueryThreshold is the duration above which a query is logged at warn.
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"LOG_SLOW_QUERY_THRESHOLD" default:"200ms"`
+}
+
+// RateLimitConfig holds the per-IP limits. Each allows Burst requests at once
+// and regains one every Interval.
+type RateLimitConfig struct {
+	// Store is "postgres", shared by all instances, or "memory", per process.
+	Store          string        `yaml:"store" env:"RATE_LIMIT_STORE" default:"postgres"`
+	LoginBurst     int           `yaml:"login_burst" env:"RATE_LIMIT_LOGIN_BURST" default:"20"`
+	LoginInterval  time.Duration `yaml:"login_interval" env:"RATE_LIMIT_LOGIN_INTERVAL" default:"3s"`
+	SignUpBurst    int           `yaml:"signup_burst" env:"RATE_LIMIT_SIGNUP_BURST" default:"5"`
+	SignUpInterval time.Duration `yaml:"signup_interval" env:"RATE_LIMIT_SIGNUP_INTERVAL" default:"1m"`
+}
+
+type MailConfig struct {
+	// Driver is "smtp", "file" (writes .eml files to Dir) or "log".
+	Driver       string `yaml:"driver" env:"MAIL_DRIVER" default:"log"`
+	From         string `yaml:"from" env:"MAIL_FROM" default:"no-reply@localhost"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT" default:"587"`
+	SMTPUser     string `yaml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword Secret `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	Dir          string `yaml:"dir" env:"MAIL_DIR" default:"mail"`
+}
+
+// PasswordConfig selects how new passwords are hashed. Hashes made with the
+// other algorithm or different parameters still verify and are upgraded on the
+// user's next login.
+type PasswordConfig struct {
+	// Algorithm is "argon2id" or "bcrypt".
+	Algorithm  string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM" default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env:"BCRYPT_COST" default:"10"`
+	// Argon2Memory is in KiB.
+	Argon2Memory      int `yaml:"argon2_memory" env:"ARGON2_MEMORY" default:"65536"`
+	Argon2Iterations  int `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS" default:"3"`
+	Argon2Parallelism int `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM" default:"2"`
+	Argon2SaltLength  int `yaml:"argon2_salt_length" env:"ARGON2_SALT_LENGTH" default:"16"`
+	Argon2KeyLength   int `yaml:"argon2_key_length" env:"ARGON2_KEY_LENGTH" default:"32"`
+}
+
+type TaskConfig struct {
+	// MaxSubtaskDepth is how many levels of subtasks may nest below a
+	// top-level task; 0 turns subtasks off.
+	MaxSubtaskDepth int `yaml:"max_subtask_depth" env:"TASK_MAX_SUBTASK_DEPTH" default:"3"`
+}
+
+// Secret is a string that prints as [REDACTED] so it can't leak through logs.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+// LogValue implements slog.LogValuer.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// Value returns the secret itself.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// Load parses the configuration and checks that every required field is set.
+func Load() (Config, error) {
+	cfg, err := Parse()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := Validate(cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Parse builds the configuration without checking required fields, for tools
+// such as the migrator that only need some sections; see Validate.
+func Parse() (Config, error) {
+	cfg := Config{}
+	if err := walk(reflect.ValueOf(&cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) error {
+		if value, ok := tag.Lookup("default"); ok {
+			return setField(field, value)
+		}
+		return nil
+	}); err != nil {
+		return Config{}, err
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.Unmarshal(b, &cfg); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	envFile := ".env"
+	if path := os.Getenv("ENV_FILE"); path != "" {
+		envFile = path
+	}
+	// godotenv never overrides variables that are already set in the environment.
+	if err := godotenv.Load(envFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("%s: %w", envFile, err)
+	}
+
+	if err := walk(reflect.ValueOf(&cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) error {
+		name := tag.Get("env")
+		if value, ok := os.LookupEnv(name); ok && name != "" {
+			if err := setField(field, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every required field left empty in section, which is
+// either a Config or one of its sections.
+func Validate(section interface{}) error {
+	missing := []string{}
+	walk(reflect.Indirect(reflect.ValueOf(section)), func(field reflect.Value, tag reflect.StructTag) error {
+		if tag.Get("required") == "true" && field.IsZero() {
+			missing = append(missing, tag.Get("env"))
+		}
+		return nil
+	})
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// walk calls fn for every leaf field of the struct v, descending into nested sections.
+func walk(v reflect.Value, fn func(field reflect.Value, tag reflect.StructTag) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walk(field, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, t.Field(i).Tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
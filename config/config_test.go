@@ -0,0 +1,71 @@
+package config_test
+
+import (
+	"fmt"
+	"go-rest-api/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setRequired(t *testing.T) {
+	t.Setenv("ENV_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	t.Setenv("POSTGRES_USER", "udemy")
+	t.Setenv("POSTGRES_PW", "hunter2")
+	t.Setenv("POSTGRES_HOST", "localhost")
+	t.Setenv("POSTGRES_DB", "udemy")
+	t.Setenv("SECRET", "jwt-secret")
+}
+
+func TestLoadAppliesDefaultsAndEnv(t *testing.T) {
+	setRequired(t)
+	t.Setenv("SERVER_ADDR", ":9090")
+	t.Setenv("ACCESS_TOKEN_TTL", "5m")
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", cfg.Server.Addr)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, 720*time.Hour, cfg.Auth.RefreshTokenTTL)
+	assert.Equal(t, "5432", cfg.Database.Port)
+	assert.Equal(t, "jwt-secret", cfg.Auth.Secret.Value())
+}
+
+func TestLoadReadsYAMLBelowEnv(t *testing.T) {
+	setRequired(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("server:\n  addr: \":7070\"\n  idle_timeout: 90s\ndatabase:\n  host: yaml-host\n"), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, ":7070", cfg.Server.Addr)
+	assert.Equal(t, 90*time.Second, cfg.Server.IdleTimeout)
+	assert.Equal(t, "localhost", cfg.Database.Host)
+}
+
+func TestLoadRequiresSecrets(t *testing.T) {
+	setRequired(t)
+	t.Setenv("SECRET", "")
+	_, err := config.Load()
+	assert.EqualError(t, err, "missing required configuration: SECRET")
+}
+
+func TestLoadRejectsMalformedValues(t *testing.T) {
+	setRequired(t)
+	t.Setenv("SERVER_WRITE_TIMEOUT", "soon")
+	_, err := config.Load()
+	assert.Error(t, err)
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	setRequired(t)
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	for _, printed := range []string{fmt.Sprint(cfg), fmt.Sprintf("%+v", cfg), fmt.Sprintf("%#v", cfg)} {
+		assert.NotContains(t, printed, "hunter2")
+		assert.NotContains(t, printed, "jwt-secret")
+		assert.Contains(t, printed, "[REDACTED]")
+	}
+}
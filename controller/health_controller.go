@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"go-rest-api/health"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IHealthController interface {
+	Healthz(c echo.Context) error
+	Readyz(c echo.Context) error
+}
+
+type healthController struct {
+	hr *health.Registry
+}
+
+func NewHealthController(hr *health.Registry) IHealthController {
+	return &healthController{hr}
+}
+
+// Healthz only reports that the process is serving requests; it never touches dependencies.
+func (hc *healthController) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": health.StatusOK})
+}
+
+func (hc *healthController) Readyz(c echo.Context) error {
+	report := hc.hr.Run(c.Request().Context())
+	if report.Status != health.StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"go-rest-api/model"
+	"go-rest-api/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type IProjectController interface {
+	GetAllProjects(c echo.Context) error
+	GetProjectById(c echo.Context) error
+	CreateProject(c echo.Context) error
+	UpdateProject(c echo.Context) error
+	DeleteProject(c echo.Context) error
+	GetMembers(c echo.Context) error
+	InviteMember(c echo.Context) error
+	RemoveMember(c echo.Context) error
+}
+
+type projectController struct {
+	pu usecase.IProjectUseCase
+}
+
+func NewProjectController(pu usecase.IProjectUseCase) IProjectController {
+	return &projectController{pu}
+}
+
+func (pc *projectController) GetAllProjects(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projects, err := pc.pu.GetAllProjects(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, projects)
+}
+
+func (pc *projectController) GetProjectById(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	project, err := pc.pu.GetProjectByID(c.Request().Context(), userId, uint(projectId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, project)
+}
+
+func (pc *projectController) CreateProject(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	project := model.Project{}
+	if err := c.Bind(&project); err != nil {
+		return err
+	}
+	project.UserID = &userId
+	projectResponse, err := pc.pu.CreateProject(c.Request().Context(), project)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, projectResponse)
+}
+
+func (pc *projectController) UpdateProject(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	project := model.Project{}
+	if err := c.Bind(&project); err != nil {
+		return err
+	}
+	project.UserID = &userId
+	projectResponse, err := pc.pu.UpdateProject(c.Request().Context(), project, uint(userId), uint(projectId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, projectResponse)
+}
+
+// DeleteProject reads ?tasks=move|delete and, for move, ?move_to=<project id>
+// to choose what happens to the project's tasks. By default they are kept
+// without a project.
+func (pc *projectController) DeleteProject(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	deletion := model.ProjectDeletion{}
+	err = echo.QueryParamsBinder(c).
+		String("tasks", &deletion.Tasks).
+		Uint64("move_to", &deletion.MoveTo).
+		BindError()
+	if err != nil {
+		return err
+	}
+	if err := pc.pu.DeleteProject(c.Request().Context(), userId, uint(projectId), deletion); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (pc *projectController) GetMembers(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	members, err := pc.pu.GetMembers(c.Request().Context(), userId, uint(projectId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+func (pc *projectController) InviteMember(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	invitation := model.ProjectInvitation{}
+	if err := c.Bind(&invitation); err != nil {
+		return err
+	}
+	member, err := pc.pu.InviteMember(c.Request().Context(), userId, uint(projectId), invitation)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, member)
+}
+
+func (pc *projectController) RemoveMember(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	projectId, err := strconv.Atoi(c.Param("projectId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	memberId, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user id")
+	}
+	if err := pc.pu.RemoveMember(c.Request().Context(), userId, uint(projectId), uint(memberId)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"go-rest-api/model"
+	"go-rest-api/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type ITagController interface {
+	GetAllTags(c echo.Context) error
+	GetTagById(c echo.Context) error
+	CreateTag(c echo.Context) error
+	UpdateTag(c echo.Context) error
+	DeleteTag(c echo.Context) error
+}
+
+type tagController struct {
+	tu usecase.ITagUseCase
+}
+
+func NewTagController(tu usecase.ITagUseCase) ITagController {
+	return &tagController{tu}
+}
+
+func (tc *tagController) GetAllTags(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	tags, err := tc.tu.GetAllTags(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+func (tc *tagController) GetTagById(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid tag id")
+	}
+	tag, err := tc.tu.GetTagByID(c.Request().Context(), userId, uint(tagId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tag)
+}
+
+func (tc *tagController) CreateTag(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	tag := model.Tag{}
+	if err := c.Bind(&tag); err != nil {
+		return err
+	}
+	tag.UserID = userId
+	tagResponse, err := tc.tu.CreateTag(c.Request().Context(), tag)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, tagResponse)
+}
+
+func (tc *tagController) UpdateTag(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid tag id")
+	}
+	tag := model.Tag{}
+	if err := c.Bind(&tag); err != nil {
+		return err
+	}
+	tag.UserID = userId
+	tagResponse, err := tc.tu.UpdateTag(c.Request().Context(), tag, uint(userId), uint(tagId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tagResponse)
+}
+
+func (tc *tagController) DeleteTag(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	tagId, err := strconv.Atoi(c.Param("tagId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid tag id")
+	}
+	if err := tc.tu.DeleteTag(c.Request().Context(), userId, uint(tagId)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
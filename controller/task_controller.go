@@ -1,21 +1,33 @@
 package controller
 
 import (
+	"fmt"
 	"go-rest-api/model"
 	"go-rest-api/usecase"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
+const mimeApplicationMergePatchJSON = "application/merge-patch+json"
+
 type ITaskController interface {
 	GetAllTasks(c echo.Context) error
 	GetAllTasksById(c echo.Context) error
 	CreateTask(c echo.Context) error
 	UpdateTask(c echo.Context) error
+	PatchTask(c echo.Context) error
 	DeleteTask(c echo.Context) error
+	AddDependency(c echo.Context) error
+	RemoveDependency(c echo.Context) error
+	GetTaskGraph(c echo.Context) error
+	GetTaskOrder(c echo.Context) error
 }
 
 type taskController struct {
@@ -30,9 +42,50 @@ func (tc *taskController) GetAllTasks(c echo.Context) error {
 	user := c.Get("user").(*jwt.Token)
 	claims := user.Claims.(jwt.MapClaims)
 	userId := uint(claims["user_id"].(float64))
-	tasks, err := tc.tu.GetAllTasks(userId)
+	query := model.TaskQuery{}
+	var tags string
+	err := echo.QueryParamsBinder(c).
+		String("cursor", &query.Cursor).
+		Int("limit", &query.Limit).
+		Uint64("project_id", &query.ProjectID).
+		Uint64("parent_id", &query.ParentID).
+		String("title", &query.Title).
+		Time("created_from", &query.CreatedFrom, time.RFC3339).
+		Time("created_to", &query.CreatedTo, time.RFC3339).
+		Time("updated_from", &query.UpdatedFrom, time.RFC3339).
+		Time("updated_to", &query.UpdatedTo, time.RFC3339).
+		String("sort", &query.Sort).
+		String("order", &query.Order).
+		String("tags", &tags).
+		String("tag_match", &query.TagMatch).
+		String("embed", &query.Embed).
+		BindError()
+	if err != nil {
+		return err
+	}
+	// ?tags=bug,urgent
+	if tags != "" {
+		query.Tags = strings.Split(tags, ",")
+	}
+	// Under /projects/:projectId/tasks the path names the project.
+	projectId, err := projectParam(c)
+	if err != nil {
+		return err
+	}
+	if projectId != nil {
+		query.ProjectID = *projectId
+	}
+	// Under /tasks/:taskId/subtasks the path names the parent.
+	parentId, err := taskParam(c)
+	if err != nil {
+		return err
+	}
+	if parentId != nil {
+		query.ParentID = *parentId
+	}
+	tasks, err := tc.tu.GetAllTasks(c.Request().Context(), userId, query)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	return c.JSON(http.StatusOK, tasks)
 }
@@ -43,12 +96,13 @@ func (tc *taskController) GetAllTasksById(c echo.Context) error {
 	userId := uint(claims["user_id"].(float64))
 	taskId, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
 	}
-	task, err := tc.tu.GetTaskByID(userId, uint(taskId))
+	task, err := tc.tu.GetTaskByID(c.Request().Context(), userId, uint(taskId))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
+	setETag(c, task.Version)
 	return c.JSON(http.StatusOK, task)
 }
 
@@ -58,13 +112,28 @@ func (tc *taskController) CreateTask(c echo.Context) error {
 	userId := uint64(claims["user_id"].(float64))
 	task := model.Task{}
 	if err := c.Bind(&task); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
+	}
+	task.UserID = &userId
+	projectId, err := projectParam(c)
+	if err != nil {
+		return err
 	}
-	task.UserID = userId
-	taskResponse, err := tc.tu.CreateTask(task)
+	if projectId != nil {
+		task.ProjectID = projectId
+	}
+	parentId, err := taskParam(c)
+	if err != nil {
+		return err
+	}
+	if parentId != nil {
+		task.ParentID = parentId
+	}
+	taskResponse, err := tc.tu.CreateTask(c.Request().Context(), task)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
+	setETag(c, taskResponse.Version)
 	return c.JSON(http.StatusOK, taskResponse)
 }
 
@@ -74,17 +143,50 @@ func (tc *taskController) UpdateTask(c echo.Context) error {
 	userId := uint64(claims["user_id"].(float64))
 	taskId, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		return err
 	}
 	task := model.Task{}
 	if err := c.Bind(&task); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
 	}
-	task.UserID = userId
-	taskResponse, err := tc.tu.UpdateTask(task, uint(userId), uint(taskId))
+	task.UserID = &userId
+	taskResponse, err := tc.tu.UpdateTask(c.Request().Context(), task, uint(userId), uint(taskId), version)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
+	setETag(c, taskResponse.Version)
+	return c.JSON(http.StatusOK, taskResponse)
+}
+
+func (tc *taskController) PatchTask(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if contentType != mimeApplicationMergePatchJSON && contentType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be "+mimeApplicationMergePatchJSON)
+	}
+	version, err := parseIfMatch(c)
+	if err != nil {
+		return err
+	}
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	taskResponse, err := tc.tu.PatchTask(c.Request().Context(), patch, userId, uint(taskId), version)
+	if err != nil {
+		return err
+	}
+	setETag(c, taskResponse.Version)
 	return c.JSON(http.StatusOK, taskResponse)
 }
 
@@ -94,11 +196,124 @@ func (tc *taskController) DeleteTask(c echo.Context) error {
 	userId := uint(claims["user_id"].(float64))
 	taskId, err := strconv.Atoi(c.Param("taskId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
 	}
-	err = tc.tu.DeleteTask(userId, uint(taskId))
+	err = tc.tu.DeleteTask(c.Request().Context(), userId, uint(taskId))
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	return c.JSON(http.StatusOK, "Task deleted")
 }
+
+func (tc *taskController) AddDependency(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	request := model.TaskDependencyRequest{}
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+	dependency, err := tc.tu.AddDependency(c.Request().Context(), userId, uint(taskId), uint(request.BlockerID))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, dependency)
+}
+
+func (tc *taskController) RemoveDependency(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	blockerId, err := strconv.Atoi(c.Param("blockerId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid blocker id")
+	}
+	if err := tc.tu.RemoveDependency(c.Request().Context(), userId, uint(taskId), uint(blockerId)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (tc *taskController) GetTaskGraph(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	graph, err := tc.tu.GetTaskGraph(c.Request().Context(), userId, uint(taskId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, graph)
+}
+
+func (tc *taskController) GetTaskOrder(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint(claims["user_id"].(float64))
+	taskId, err := strconv.Atoi(c.Param("taskId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	order, err := tc.tu.GetTaskOrder(c.Request().Context(), userId, uint(taskId))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// projectParam returns the :projectId path parameter, or nil on routes without one.
+func projectParam(c echo.Context) (*uint64, error) {
+	param := c.Param("projectId")
+	if param == "" {
+		return nil, nil
+	}
+	projectId, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid project id")
+	}
+	return &projectId, nil
+}
+
+// taskParam is like projectParam for the parent task under /tasks/:taskId/subtasks.
+func taskParam(c echo.Context) (*uint64, error) {
+	param := c.Param("taskId")
+	if param == "" {
+		return nil, nil
+	}
+	taskId, err := strconv.ParseUint(param, 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid task id")
+	}
+	return &taskId, nil
+}
+
+func setETag(c echo.Context, version uint64) {
+	c.Response().Header().Set("ETag", fmt.Sprintf("%q", strconv.FormatUint(version, 10)))
+}
+
+// parseIfMatch returns the version named by the If-Match header, or 0 for "*".
+func parseIfMatch(c echo.Context) (uint64, error) {
+	ifMatch := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if ifMatch == "" {
+		return 0, echo.NewHTTPError(http.StatusPreconditionRequired, "missing If-Match header")
+	}
+	if ifMatch == "*" {
+		return 0, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+	if err != nil || version == 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid If-Match header: "+ifMatch)
+	}
+	return version, nil
+}
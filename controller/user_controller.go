@@ -1,81 +1,331 @@
 package controller
 
 import (
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
 	"go-rest-api/model"
 	"go-rest-api/usecase"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
 type IUserController interface {
 	SignUp(c echo.Context) error
 	LogIn(c echo.Context) error
+	VerifyMFA(c echo.Context) error
+	Refresh(c echo.Context) error
 	LogOut(c echo.Context) error
+	LogOutAll(c echo.Context) error
+	VerifyEmail(c echo.Context) error
+	ResendVerification(c echo.Context) error
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	GetMe(c echo.Context) error
+	UpdateMe(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	DeleteMe(c echo.Context) error
+	EnrollTOTP(c echo.Context) error
+	ConfirmTOTP(c echo.Context) error
+	DisableTOTP(c echo.Context) error
+	RegenerateRecoveryCodes(c echo.Context) error
 	CsrfToken(c echo.Context) error
 }
 
 type userController struct {
-	uu usecase.IUserUseCase
+	uu  usecase.IUserUseCase
+	cfg config.HTTPConfig
 }
 
-func NewUserController(uu usecase.IUserUseCase) IUserController {
-	return &userController{uu}
+func NewUserController(uu usecase.IUserUseCase, cfg config.HTTPConfig) IUserController {
+	return &userController{uu, cfg}
 }
 
 func (uc *userController) SignUp(c echo.Context) error {
 	user := model.User{}
 	if err := c.Bind(&user); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
 	}
-	userRes, err := uc.uu.SignUp(user)
+	userRes, err := uc.uu.SignUp(c.Request().Context(), user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
 	return c.JSON(http.StatusCreated, userRes)
 }
 
+// LogIn sets the token cookies, or for accounts with two-factor
+// authentication answers with an MFA token to send to POST /login/mfa.
 func (uc *userController) LogIn(c echo.Context) error {
 	user := model.User{}
 	if err := c.Bind(&user); err != nil {
-		return c.JSON(http.StatusBadRequest, err.Error())
+		return err
 	}
-	tokenString, err := uc.uu.LogIn(user)
+	result, err := uc.uu.LogIn(c.Request().Context(), user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return err
 	}
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = tokenString
-	cookie.Expires = time.Now().Add(time.Hour * 24)
-	cookie.Path = "/"
-	cookie.Secure = true
-	cookie.Domain = os.Getenv("API_DOMAIN")
-	// cookie.Secure = true
-	cookie.HttpOnly = true
-	cookie.SameSite = http.SameSiteNoneMode
-	c.SetCookie(cookie)
+	if result.Challenge != nil {
+		return c.JSON(http.StatusOK, result.Challenge)
+	}
+	uc.setTokenCookies(c, result.Tokens)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) VerifyMFA(c echo.Context) error {
+	verification := model.MFAVerification{}
+	if err := c.Bind(&verification); err != nil {
+		return err
+	}
+	tokens, err := uc.uu.VerifyMFA(c.Request().Context(), verification)
+	if err != nil {
+		return err
+	}
+	uc.setTokenCookies(c, tokens)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) Refresh(c echo.Context) error {
+	cookie, err := c.Cookie("refresh_token")
+	if err != nil {
+		return apperror.Unauthorized("refresh token is required")
+	}
+	tokens, err := uc.uu.Refresh(c.Request().Context(), cookie.Value)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidRefreshToken) || errors.Is(err, usecase.ErrRefreshTokenReused) {
+			uc.clearTokenCookies(c)
+		}
+		return err
+	}
+	uc.setTokenCookies(c, tokens)
 	return c.NoContent(http.StatusOK)
 }
 
 func (uc *userController) LogOut(c echo.Context) error {
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = ""
-	cookie.Expires = time.Now()
-	cookie.Path = "/"
-	cookie.Secure = true
-	cookie.Domain = os.Getenv("API_DOMAIN")
-	// cookie.Secure = true
-	cookie.HttpOnly = true
-	cookie.SameSite = http.SameSiteNoneMode
-	c.SetCookie(cookie)
+	accessToken, refreshToken := "", ""
+	if cookie, err := c.Cookie("token"); err == nil {
+		accessToken = cookie.Value
+	}
+	if cookie, err := c.Cookie("refresh_token"); err == nil {
+		refreshToken = cookie.Value
+	}
+	if err := uc.uu.LogOut(c.Request().Context(), accessToken, refreshToken); err != nil {
+		return err
+	}
+	uc.clearTokenCookies(c)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) LogOutAll(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	if err := uc.uu.LogOutAll(c.Request().Context(), userId); err != nil {
+		return err
+	}
+	uc.clearTokenCookies(c)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is required")
+	}
+	if err := uc.uu.VerifyEmail(c.Request().Context(), token); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) ResendVerification(c echo.Context) error {
+	user := model.User{}
+	if err := c.Bind(&user); err != nil {
+		return err
+	}
+	if err := uc.uu.ResendVerification(c.Request().Context(), user.Email); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ForgotPassword answers 202 whether or not the email belongs to an account.
+func (uc *userController) ForgotPassword(c echo.Context) error {
+	user := model.User{}
+	if err := c.Bind(&user); err != nil {
+		return err
+	}
+	if err := uc.uu.ForgotPassword(c.Request().Context(), user.Email); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (uc *userController) ResetPassword(c echo.Context) error {
+	reset := model.PasswordReset{}
+	if err := c.Bind(&reset); err != nil {
+		return err
+	}
+	if err := uc.uu.ResetPassword(c.Request().Context(), reset); err != nil {
+		return err
+	}
+	uc.clearTokenCookies(c)
 	return c.NoContent(http.StatusOK)
 }
 
+func (uc *userController) GetMe(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	userRes, err := uc.uu.GetMe(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, userRes)
+}
+
+func (uc *userController) UpdateMe(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	change := model.EmailChange{}
+	if err := c.Bind(&change); err != nil {
+		return err
+	}
+	userRes, err := uc.uu.UpdateEmail(c.Request().Context(), userId, change)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, userRes)
+}
+
+func (uc *userController) ChangePassword(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	change := model.PasswordChange{}
+	if err := c.Bind(&change); err != nil {
+		return err
+	}
+	tokens, err := uc.uu.ChangePassword(c.Request().Context(), userId, change)
+	if err != nil {
+		return err
+	}
+	uc.setTokenCookies(c, tokens)
+	return c.NoContent(http.StatusOK)
+}
+
+// DeleteMe takes the current password in the body, like PATCH /me.
+func (uc *userController) DeleteMe(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	body := model.User{}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if err := uc.uu.DeleteAccount(c.Request().Context(), userId, body.Password); err != nil {
+		return err
+	}
+	uc.clearTokenCookies(c)
+	return c.NoContent(http.StatusOK)
+}
+
+// EnrollTOTP takes the current password in the body and returns the secret
+// to add to an authenticator app.
+func (uc *userController) EnrollTOTP(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	body := model.MFAConfirmation{}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	enrollment, err := uc.uu.EnrollTOTP(c.Request().Context(), userId, body.Password)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP takes a code from the authenticator app in the body.
+func (uc *userController) ConfirmTOTP(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	body := model.MFAConfirmation{}
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	codes, err := uc.uu.ConfirmTOTP(c.Request().Context(), userId, body.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+func (uc *userController) DisableTOTP(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	confirmation := model.MFAConfirmation{}
+	if err := c.Bind(&confirmation); err != nil {
+		return err
+	}
+	if err := uc.uu.DisableTOTP(c.Request().Context(), userId, confirmation); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) RegenerateRecoveryCodes(c echo.Context) error {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := uint64(claims["user_id"].(float64))
+	confirmation := model.MFAConfirmation{}
+	if err := c.Bind(&confirmation); err != nil {
+		return err
+	}
+	codes, err := uc.uu.RegenerateRecoveryCodes(c.Request().Context(), userId, confirmation)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
 func (uc *userController) CsrfToken(c echo.Context) error {
 	token := c.Get("csrf").(string)
 	return c.JSON(http.StatusOK, echo.Map{"csrfToken": token})
 }
+
+// legacyRefreshTokenPath is where refresh token cookies used to be scoped,
+// which kept them from POST /logout. They are replaced by cookies on "/"
+// whenever tokens are set or cleared.
+const legacyRefreshTokenPath = "/refresh"
+
+func (uc *userController) setTokenCookies(c echo.Context, tokens model.TokenPair) {
+	c.SetCookie(uc.newAuthCookie("token", tokens.AccessToken, "/", tokens.AccessTokenExpiresAt))
+	c.SetCookie(uc.newAuthCookie("refresh_token", tokens.RefreshToken, "/", tokens.RefreshTokenExpiresAt))
+	c.SetCookie(uc.newAuthCookie("refresh_token", "", legacyRefreshTokenPath, time.Now()))
+}
+
+func (uc *userController) clearTokenCookies(c echo.Context) {
+	c.SetCookie(uc.newAuthCookie("token", "", "/", time.Now()))
+	c.SetCookie(uc.newAuthCookie("refresh_token", "", "/", time.Now()))
+	c.SetCookie(uc.newAuthCookie("refresh_token", "", legacyRefreshTokenPath, time.Now()))
+}
+
+func (uc *userController) newAuthCookie(name string, value string, path string, expires time.Time) *http.Cookie {
+	cookie := new(http.Cookie)
+	cookie.Name = name
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.Path = path
+	cookie.Secure = true
+	cookie.Domain = uc.cfg.APIDomain
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteNoneMode
+	return cookie
+}
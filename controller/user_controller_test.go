@@ -0,0 +1,147 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
+	"go-rest-api/controller"
+	"go-rest-api/mailer"
+	"go-rest-api/model"
+	"go-rest-api/repository"
+	"go-rest-api/usecase"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockUserRepository struct {
+	repository.IUserRepository
+	mock.Mock
+}
+
+func (m *mockUserRepository) GetUserByEmail(ctx context.Context, user *model.User, email string) error {
+	args := m.Called(user, email)
+	if args.Get(0) != nil {
+		*user = args.Get(0).(model.User)
+	}
+	return args.Error(1)
+}
+
+type mockPasswordResetRepository struct {
+	repository.IPasswordResetRepository
+	mock.Mock
+}
+
+func (m *mockPasswordResetRepository) CreateResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+type mockMailer struct {
+	mock.Mock
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	args := m.Called(msg)
+	return args.Error(0)
+}
+
+type mockSessionRepository struct {
+	repository.ISessionRepository
+	mock.Mock
+}
+
+func (m *mockSessionRepository) GetSessionByTokenHash(ctx context.Context, session *model.Session, tokenHash string) error {
+	args := m.Called(session, tokenHash)
+	*session = args.Get(0).(model.Session)
+	return args.Error(1)
+}
+
+func (m *mockSessionRepository) RotateSession(ctx context.Context, current *model.Session, next *model.Session) error {
+	args := m.Called(current, next)
+	return args.Error(0)
+}
+
+func (m *mockSessionRepository) RevokeSessionFamily(ctx context.Context, familyId string) error {
+	args := m.Called(familyId)
+	return args.Error(0)
+}
+
+// TestLogOutRevokesSessionFamily goes through a cookie jar, so the refresh
+// token only reaches POST /logout if its cookie path covers it.
+func TestLogOutRevokesSessionFamily(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	authConfig := config.AuthConfig{Secret: "secret", AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: time.Hour}
+	uu := usecase.NewUserUseCase(nil, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), nil, nil, nil, nil, nil, nil, authConfig)
+	uc := controller.NewUserController(uu, config.HTTPConfig{})
+	e := echo.New()
+	e.POST("/refresh", uc.Refresh)
+	e.POST("/logout", uc.LogOut)
+	server := httptest.NewTLSServer(e)
+	defer server.Close()
+	client := server.Client()
+	client.Jar, _ = cookiejar.New(nil)
+	storedSession := model.Session{ID: 1, UserID: 1, FamilyID: "family", ExpiresAt: time.Now().Add(time.Hour)}
+
+	mockSessionRepo.On("GetSessionByTokenHash", mock.AnythingOfType("*model.Session"), mock.AnythingOfType("string")).Return(storedSession, nil)
+	mockSessionRepo.On("RotateSession", mock.Anything, mock.Anything).Return(nil)
+	mockSessionRepo.On("RevokeSessionFamily", "family").Return(nil)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: "refresh-token"})
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	mockSessionRepo.AssertNotCalled(t, "RevokeSessionFamily", mock.Anything)
+
+	res, err = client.Post(server.URL+"/logout", "", nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	mockSessionRepo.AssertCalled(t, "RevokeSessionFamily", "family")
+	// Cookies from before the refresh token moved to "/" are cleared too.
+	cleared := map[string]bool{}
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "refresh_token" && cookie.Value == "" {
+			cleared[cookie.Path] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"/": true, "/refresh": true}, cleared)
+}
+
+func TestForgotPasswordAcceptsEvenWhenMailFails(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockResetRepo := new(mockPasswordResetRepository)
+	mockMailer := new(mockMailer)
+	authConfig := config.AuthConfig{Secret: "secret", PasswordResetTokenTTL: time.Hour}
+	uu := usecase.NewUserUseCase(mockUserRepo, nil, nil, repository.NewMemoryRateLimitRepository(), mockResetRepo, nil, nil, nil, nil, mockMailer, authConfig)
+	uc := controller.NewUserController(uu, config.HTTPConfig{})
+	e := echo.New()
+	e.POST("/password/forgot", uc.ForgotPassword)
+
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "test@example.com").Return(model.User{ID: 1, Email: "test@example.com"}, nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "nobody@example.com").Return(nil, apperror.NotFound("user not found"))
+	mockResetRepo.On("CreateResetToken", mock.AnythingOfType("*model.PasswordResetToken")).Return(nil)
+	mockMailer.On("Send", mock.AnythingOfType("mailer.Message")).Return(errors.New("smtp unavailable"))
+	for _, email := range []string{"test@example.com", "nobody@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusAccepted, rec.Code, email)
+	}
+	// Only the known address gets a reset link, once the mail goes out.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, uu.Drain(ctx))
+	mockMailer.AssertNumberOfCalls(t, "Send", 1)
+	mockMailer.AssertCalled(t, "Send", mock.MatchedBy(func(msg mailer.Message) bool { return msg.To == "test@example.com" }))
+}
@@ -1,29 +1,29 @@
 package db
 
 import (
-	"fmt"
+	"context"
+	"go-rest-api/config"
 	"log"
-	"os"
+	"net"
+	"net/url"
 
-	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
-func NewDB() *gorm.DB {
-	if os.Getenv("GO_ENV") == "dev" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Fatal("Error loading .env file")
-		}
+func NewDB(cfg config.DatabaseConfig, logger gormlogger.Interface) *gorm.DB {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.User, cfg.Password.Value()),
+		Host:   net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:   "/" + cfg.Name,
 	}
-	url := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PW"), os.Getenv("POSTGRES_HOST"), os.Getenv(("POSTGRES_PORT")), os.Getenv("POSTGRES_DB"))
-	db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn.String()), &gorm.Config{TranslateError: true, Logger: logger})
 	if err != nil {
 		log.Fatalln("failed to connect database:", err)
 	}
-	fmt.Println("connected to database")
+	logger.Info(context.Background(), "connected to database")
 	return db
 }
 
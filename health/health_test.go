@@ -0,0 +1,47 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/health"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryRunReportsFailures(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register("ok", func(ctx context.Context) (interface{}, error) {
+		return map[string]int{"open": 1}, nil
+	})
+	registry.Register("broken", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	report := registry.Run(context.Background())
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["ok"].Status)
+	assert.Equal(t, map[string]int{"open": 1}, report.Checks["ok"].Details)
+	assert.Equal(t, "connection refused", report.Checks["broken"].Error)
+}
+
+func TestRegistryRunTimesOutSlowChecks(t *testing.T) {
+	registry := health.NewRegistry(20 * time.Millisecond)
+	registry.Register("slow", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	report := registry.Run(context.Background())
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestReadinessCheck(t *testing.T) {
+	ready := true
+	check := health.ReadinessCheck(func() bool { return ready })
+	_, err := check(context.Background())
+	assert.NoError(t, err)
+	ready = false
+	_, err = check(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey struct{}
+
+// requestInfo is shared by pointer so middleware running after the request
+// ID is assigned, such as authentication, can still add the user.
+type requestInfo struct {
+	requestID string
+
+	mu     sync.Mutex
+	userID uint64
+	hasID  bool
+}
+
+func (i *requestInfo) user() (uint64, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.userID, i.hasID
+}
+
+func fromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return info
+}
+
+// WithRequestID returns a context whose log records carry requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestInfo{requestID: requestID})
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	if info := fromContext(ctx); info != nil {
+		return info.requestID
+	}
+	return ""
+}
+
+// SetUserID tags every later log record of the request with userID. It is a
+// no-op for contexts not created by WithRequestID.
+func SetUserID(ctx context.Context, userID uint64) {
+	if info := fromContext(ctx); info != nil {
+		info.mu.Lock()
+		info.userID, info.hasID = userID, true
+		info.mu.Unlock()
+	}
+}
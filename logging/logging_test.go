@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-rest-api/config"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func discardLogger(t *testing.T) *slog.Logger {
+	logger, err := New(io.Discard, config.LogConfig{Level: "error"})
+	require.NoError(t, err)
+	return logger
+}
+
+func TestNewRejectsUnknownLevel(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, config.LogConfig{Level: "loud"})
+	assert.Error(t, err)
+}
+
+func TestSensitiveValuesAreRedacted(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, config.LogConfig{Level: "info"})
+	require.NoError(t, err)
+
+	logger.Info("login", "password", "hunter2", "Refresh_Token", "abc", "jwt", config.Secret("s3cret"), "email", "a@example.com")
+
+	entry := decodeLines(t, buf)[0]
+	assert.Equal(t, "[REDACTED]", entry["password"])
+	assert.Equal(t, "[REDACTED]", entry["Refresh_Token"])
+	assert.Equal(t, "[REDACTED]", entry["jwt"])
+	assert.Equal(t, "a@example.com", entry["email"])
+}
+
+func TestMiddlewareTagsLinesWithRequestAndUser(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger, err := New(buf, config.LogConfig{Level: "info"})
+	require.NoError(t, err)
+	e := echo.New()
+	e.Use(Middleware(logger))
+	e.GET("/tasks/:taskId", func(c echo.Context) error {
+		SetUserID(c.Request().Context(), 7)
+		logger.InfoContext(c.Request().Context(), "handled")
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks/1?token=abc", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, "req-1", rec.Header().Get(echo.HeaderXRequestID))
+	lines := decodeLines(t, buf)
+	require.Len(t, lines, 2)
+	for _, entry := range lines {
+		assert.Equal(t, "req-1", entry["request_id"])
+		assert.Equal(t, float64(7), entry["user_id"])
+	}
+	assert.Equal(t, "/tasks/:taskId", lines[1]["route"])
+	assert.Equal(t, "/tasks/1", lines[1]["path"])
+	assert.Equal(t, float64(http.StatusNoContent), lines[1]["status"])
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(discardLogger(t)))
+	var seen string
+	e.GET("/", func(c echo.Context) error {
+		seen = RequestID(c.Request().Context())
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "bad id\n")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rec.Header().Get(echo.HeaderXRequestID))
+}
+
+func TestGormLoggerOmitsBindParameters(t *testing.T) {
+	gl := NewGormLogger(discardLogger(t), 0).(*gormLogger)
+	sql, params := gl.ParamsFilter(context.Background(), "SELECT * FROM users WHERE email = $1", "a@example.com")
+	assert.Equal(t, "SELECT * FROM users WHERE email = $1", sql)
+	assert.Empty(t, params)
+}
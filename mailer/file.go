@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer writes each message to its own .eml file in dir, for local
+// development without a mail server.
+func NewFileMailer(dir string, from string) Mailer {
+	return &fileMailer{dir, from}
+}
+
+func (fm *fileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	body, err := render(fm.from, msg, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(fm.dir, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102150405") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(fm.dir, name), body, 0o600)
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+type logMailer struct {
+	logger *slog.Logger
+}
+
+// NewLogMailer writes messages to the log instead of sending them. Bodies may
+// contain live tokens, so it is meant for local development only.
+func NewLogMailer(logger *slog.Logger) Mailer {
+	return &logMailer{logger}
+}
+
+func (lm *logMailer) Send(ctx context.Context, msg Message) error {
+	lm.logger.InfoContext(ctx, "mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir, "no-reply@example.com")
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Verify", Body: "hello"})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "To: user@example.com\r\n")
+	assert.True(t, strings.HasSuffix(string(b), "\r\n\r\nhello"))
+}
+
+func TestRenderRejectsHeaderInjection(t *testing.T) {
+	_, err := render("no-reply@example.com", Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Verify"}, time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go-rest-api/config"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type smtpMailer struct {
+	cfg config.MailConfig
+}
+
+// NewSMTPMailer sends through the configured SMTP server, authenticating
+// with PLAIN auth when a username is set. net/smtp upgrades to STARTTLS
+// whenever the server offers it.
+func NewSMTPMailer(cfg config.MailConfig) Mailer {
+	return &smtpMailer{cfg}
+}
+
+func (sm *smtpMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if sm.cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", sm.cfg.SMTPUser, sm.cfg.SMTPPassword.Value(), sm.cfg.SMTPHost)
+	}
+	body, err := render(sm.cfg.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(sm.cfg.SMTPHost, sm.cfg.SMTPPort)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, sm.cfg.From, []string{msg.To}, body)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("send mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// render formats msg as an RFC 5322 message. The recipient is parsed first so
+// a crafted address can't inject extra headers.
+func render(from string, msg Message, date time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes(), nil
+}
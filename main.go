@@ -1,25 +1,104 @@
 package main
 
 import (
+	"context"
+	"go-rest-api/config"
 	"go-rest-api/controller"
 	"go-rest-api/db"
+	"go-rest-api/health"
+	"go-rest-api/logging"
+	"go-rest-api/mailer"
+	"go-rest-api/metrics"
 	"go-rest-api/repository"
 	"go-rest-api/router"
+	"go-rest-api/server"
 	"go-rest-api/usecase"
 	"go-rest-api/validator"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	dbConn := db.NewDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
+	logger, err := logging.New(os.Stdout, cfg.Log)
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
+	slog.SetDefault(logger)
+	dbConn := db.NewDB(cfg.Database, logging.NewGormLogger(logger, cfg.Log.SlowQueryThreshold))
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		log.Fatalln("failed to get database handle:", err)
+	}
+	appMetrics := metrics.New(sqlDB)
+	if err := dbConn.Use(appMetrics.GormPlugin()); err != nil {
+		log.Fatalln("failed to register metrics plugin:", err)
+	}
+	appMailer, err := mailer.New(cfg.Mail, logger)
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
+	passwordHasher, err := usecase.NewPasswordHasher(cfg.Password)
+	if err != nil {
+		log.Fatalln("invalid configuration:", err)
+	}
 	userValidator := validator.NewUserValidator()
 	taskValidator := validator.NewTaskValidator()
+	projectValidator := validator.NewProjectValidator()
+	tagValidator := validator.NewTagValidator()
 	userRepository := repository.NewUserRepository(dbConn)
 	taskRepository := repository.NewTaskRepository(dbConn)
-	userUsecase := usecase.NewUserUseCase(userRepository, userValidator, nil)
-	taskUsecase := usecase.NewTaskUseCase(taskRepository, taskValidator)
-	userController := controller.NewUserController(userUsecase)
+	taskDependencyRepository := repository.NewTaskDependencyRepository(dbConn)
+	projectRepository := repository.NewProjectRepository(dbConn)
+	projectMemberRepository := repository.NewProjectMemberRepository(dbConn)
+	tagRepository := repository.NewTagRepository(dbConn)
+	sessionRepository := repository.NewSessionRepository(dbConn)
+	revocationRepository := repository.NewRevocationRepository(dbConn)
+	passwordResetRepository := repository.NewPasswordResetRepository(dbConn)
+	mfaRepository := repository.NewMFARepository(dbConn)
+	var rateLimitRepository repository.IRateLimitRepository
+	switch cfg.RateLimit.Store {
+	case "postgres":
+		rateLimitRepository = repository.NewRateLimitRepository(dbConn)
+	case "memory":
+		rateLimitRepository = repository.NewMemoryRateLimitRepository()
+	default:
+		log.Fatalln("invalid configuration: unknown rate limit store", cfg.RateLimit.Store)
+	}
+	userUsecase := usecase.NewUserUseCase(userRepository, sessionRepository, revocationRepository, rateLimitRepository, passwordResetRepository, mfaRepository, userValidator, passwordHasher, appMetrics, appMailer, cfg.Auth)
+	taskUsecase := usecase.NewTaskAuthorizer(
+		usecase.NewTaskUseCase(taskRepository, taskDependencyRepository, projectMemberRepository, taskValidator, cfg.Task),
+		taskRepository, projectMemberRepository)
+	projectUsecase := usecase.NewProjectUseCase(projectRepository, projectMemberRepository, userRepository, projectValidator)
+	tagUsecase := usecase.NewTagUseCase(tagRepository, tagValidator)
+	readiness := &server.Readiness{}
+	healthRegistry := health.NewRegistry(cfg.Health.CheckTimeout)
+	healthRegistry.Register("server", health.ReadinessCheck(readiness.Ready))
+	healthRegistry.Register("database", health.DatabaseCheck(sqlDB))
+	userController := controller.NewUserController(userUsecase, cfg.HTTP)
 	taskController := controller.NewTaskController(taskUsecase)
-	e := router.NewRouter(userController, taskController)
-	e.Logger.Fatal(e.Start(":8080"))
+	projectController := controller.NewProjectController(projectUsecase)
+	tagController := controller.NewTagController(tagUsecase)
+	healthController := controller.NewHealthController(healthRegistry)
+	e := router.NewRouter(cfg, userController, taskController, projectController, tagController, healthController, revocationRepository, rateLimitRepository, appMetrics, logger)
+	ops := router.NewOpsRouter(appMetrics)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := server.Run(ctx, e, ops, cfg.Server, readiness); err != nil {
+		logger.Error("server stopped", "error", err)
+	}
+	// Let mail queued by the last requests go out while the database is open.
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := userUsecase.Drain(drainCtx); err != nil {
+		logger.Error("background mail dropped", "error", err)
+	}
+	cancel()
 	db.CloseDB(dbConn)
 }
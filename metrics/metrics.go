@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// Metrics owns the Prometheus registry and every collector the service exports.
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	dbQueryDuration *prometheus.HistogramVec
+	signups         prometheus.Counter
+	logins          prometheus.Counter
+	loginFailures   prometheus.Counter
+}
+
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route template, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "GORM statement latency by operation, table and outcome.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "table", "outcome"}),
+		signups: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "auth_signups_total",
+			Help: "Accounts created.",
+		}),
+		logins: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "auth_logins_total",
+			Help: "Successful logins.",
+		}),
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "auth_login_failures_total",
+			Help: "Logins rejected because of a wrong email or password.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "postgres"),
+		m.httpRequests,
+		m.httpDuration,
+		m.dbQueryDuration,
+		m.signups,
+		m.logins,
+		m.loginFailures,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// Middleware records every request under its route template rather than the
+// raw path, so /tasks/1 and /tasks/2 share one series.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				// Render the error now so the status code below is the one the client gets.
+				c.Error(err)
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			labels := prometheus.Labels{
+				"route":  route,
+				"method": c.Request().Method,
+				"status": strconv.Itoa(c.Response().Status),
+			}
+			m.httpRequests.With(labels).Inc()
+			m.httpDuration.With(labels).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
+
+func (m *Metrics) SignUp() {
+	m.signups.Inc()
+}
+
+func (m *Metrics) LogIn() {
+	m.logins.Inc()
+}
+
+func (m *Metrics) LogInFailure() {
+	m.loginFailures.Inc()
+}
+
+const startKey = "metrics:start"
+
+// GormPlugin times every statement GORM runs. Register it with db.Use.
+func (m *Metrics) GormPlugin() gorm.Plugin {
+	return &gormPlugin{m}
+}
+
+type gormPlugin struct {
+	m *Metrics
+}
+
+func (p *gormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for operation, register := range map[string][2]func(string, func(*gorm.DB)) error{
+		"create": {cb.Create().Before("*").Register, cb.Create().After("*").Register},
+		"query":  {cb.Query().Before("*").Register, cb.Query().After("*").Register},
+		"update": {cb.Update().Before("*").Register, cb.Update().After("*").Register},
+		"delete": {cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+		"row":    {cb.Row().Before("*").Register, cb.Row().After("*").Register},
+		"raw":    {cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+	} {
+		if err := register[0]("metrics:before_"+operation, p.before); err != nil {
+			return err
+		}
+		if err := register[1]("metrics:after_"+operation, p.after(operation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gormPlugin) before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func (p *gormPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, _ := value.(time.Time)
+		outcome := "ok"
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			outcome = "error"
+		}
+		p.m.dbQueryDuration.WithLabelValues(operation, db.Statement.Table, outcome).Observe(time.Since(start).Seconds())
+	}
+}
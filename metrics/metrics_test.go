@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"database/sql"
+	"go-rest-api/metrics"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	m := metrics.New(&sql.DB{})
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/tasks/:taskId", func(c echo.Context) error {
+		if c.Param("taskId") == "2" {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/metrics", m.Handler())
+	m.LogInFailure()
+
+	for _, path := range []string{"/tasks/1", "/tasks/2", "/tasks/3"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/tasks/:taskId",status="200"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/tasks/:taskId",status="404"} 1`)
+	assert.Contains(t, body, "auth_login_failures_total 1")
+	assert.False(t, strings.Contains(body, `route="/tasks/1"`))
+}
@@ -1,16 +1,123 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go-rest-api/config"
 	"go-rest-api/db"
-	"go-rest-api/model"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
+const usage = `usage: migrate [-dir path] <command>
+
+commands:
+  up                 apply all pending migrations
+  down N             revert the N most recently applied migrations
+  status             list migrations and whether they are applied
+  create <name>      write an empty up/down migration pair
+  force <version>    mark migrations up to version as applied without running them
+`
+
 func main() {
-	dbConn := db.NewDB()
-	defer db.CloseDB(dbConn)
-	defer fmt.Println("Successfully Migrated")
-	if err := dbConn.AutoMigrate(&model.User{}, &model.Task{}); err != nil {
-		fmt.Println("Error Migrating")
+	dir := flag.String("dir", "migrate/migrations", "directory containing migration files")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		paths, err := createMigration(*dir, args[1], time.Now())
+		if err != nil {
+			log.Fatalln("Error creating migration:", err)
+		}
+		for _, path := range paths {
+			fmt.Println("created", path)
+		}
+		return
+	}
+
+	var n int64
+	switch args[0] {
+	case "up", "status":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+	case "down", "force":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		var err error
+		if n, err = strconv.ParseInt(args[1], 10, 64); err != nil || n < 0 || (args[0] == "down" && n == 0) {
+			log.Fatalf("Invalid argument for %s: %s", args[0], args[1])
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	migrations, err := loadMigrations(os.DirFS(*dir))
+	if err != nil {
+		log.Fatalln("Error loading migrations:", err)
+	}
+	cfg, err := config.Parse()
+	if err != nil {
+		log.Fatalln("Error loading configuration:", err)
+	}
+	if err := config.Validate(cfg.Database); err != nil {
+		log.Fatalln("Error loading configuration:", err)
+	}
+	dbConn := db.NewDB(cfg.Database, gormlogger.Default)
+	err = run(dbConn, migrations, args[0], n)
+	db.CloseDB(dbConn)
+	if err != nil {
+		log.Fatalln("Error Migrating:", err)
+	}
+	if args[0] != "status" {
+		fmt.Println("Successfully Migrated")
+	}
+}
+
+func run(dbConn *gorm.DB, migrations []migration, command string, n int64) error {
+	ctx := context.Background()
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := &runner{conn: conn, migrations: migrations}
+	unlock, err := r.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	switch command {
+	case "up":
+		return r.up(ctx, os.Stdout)
+	case "down":
+		return r.down(ctx, os.Stdout, int(n))
+	case "status":
+		return r.status(ctx, os.Stdout)
+	default:
+		return r.force(ctx, n)
 	}
 }
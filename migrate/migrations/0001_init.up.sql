@@ -0,0 +1,68 @@
+-- Baseline schema. Written with IF NOT EXISTS so it also applies cleanly to
+-- databases that were previously created by GORM's AutoMigrate, adding the
+-- task columns those may predate.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    email varchar(255) NOT NULL,
+    password varchar(100) NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    update_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT users_email_key UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    id bigserial PRIMARY KEY,
+    title varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'todo',
+    priority varchar(20) NOT NULL DEFAULT 'medium',
+    due_date timestamptz,
+    completed_at timestamptz,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    update_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    user_id bigint NOT NULL,
+    CONSTRAINT fk_tasks_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS status varchar(20) NOT NULL DEFAULT 'todo';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority varchar(20) NOT NULL DEFAULT 'medium';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS due_date timestamptz;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at timestamptz;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+-- Titles used to be unique across all users.
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_title_key;
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks (status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_user_id_lower_title ON tasks (user_id, lower(title));
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial PRIMARY KEY,
+    family_id varchar(64) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    user_id bigint NOT NULL,
+    CONSTRAINT sessions_token_hash_key UNIQUE (token_hash),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_family_id ON sessions (family_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti varchar(64) PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id bigint PRIMARY KEY,
+    revoked_before timestamptz NOT NULL,
+    CONSTRAINT fk_user_token_revocations_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE rate_limit_buckets (
+    key varchar(255) PRIMARY KEY,
+    tokens double precision NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
+
+CREATE TABLE login_failures (
+    key varchar(255) PRIMARY KEY,
+    count integer NOT NULL,
+    last_failed_at timestamptz NOT NULL
+);
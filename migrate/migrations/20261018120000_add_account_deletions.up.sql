@@ -0,0 +1,7 @@
+CREATE TABLE account_deletions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    deleted_at timestamptz NOT NULL
+);
+
+CREATE INDEX idx_account_deletions_user_id ON account_deletions (user_id);
@@ -0,0 +1,2 @@
+-- argon2id hashes in PHC format outgrow the 100 characters sized for bcrypt.
+ALTER TABLE users ALTER COLUMN password TYPE varchar(255);
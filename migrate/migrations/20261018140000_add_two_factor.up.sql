@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN totp_secret varchar(64);
+ALTER TABLE users ADD COLUMN totp_enabled_at timestamptz;
+ALTER TABLE users ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id bigserial PRIMARY KEY,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    user_id bigint NOT NULL,
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE projects (
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    update_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    user_id bigint NOT NULL,
+    CONSTRAINT fk_projects_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_projects_user_id_lower_name ON projects (user_id, lower(name));
+
+ALTER TABLE tasks ADD COLUMN project_id bigint;
+ALTER TABLE tasks ADD CONSTRAINT fk_tasks_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE SET NULL;
+CREATE INDEX idx_tasks_project_id ON tasks (project_id);
@@ -0,0 +1,15 @@
+CREATE TABLE project_members (
+    project_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    role varchar(20) NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id),
+    CONSTRAINT fk_project_members_project FOREIGN KEY (project_id) REFERENCES projects (id) ON DELETE CASCADE,
+    CONSTRAINT fk_project_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_project_members_user_id ON project_members (user_id);
+
+-- Every existing project is owned by the user who created it.
+INSERT INTO project_members (project_id, user_id, role, created_at)
+SELECT id, user_id, 'owner', created_at FROM projects;
@@ -0,0 +1,20 @@
+CREATE TABLE tags (
+    id bigserial PRIMARY KEY,
+    name varchar(30) NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    update_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    user_id bigint NOT NULL,
+    CONSTRAINT fk_tags_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_tags_user_id_lower_name ON tags (user_id, lower(name));
+
+CREATE TABLE task_tags (
+    task_id bigint NOT NULL,
+    tag_id bigint NOT NULL,
+    PRIMARY KEY (task_id, tag_id),
+    CONSTRAINT fk_task_tags_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_task_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_task_tags_tag_id ON task_tags (tag_id);
@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS auto_complete;
+ALTER TABLE tasks DROP COLUMN IF EXISTS parent_id;
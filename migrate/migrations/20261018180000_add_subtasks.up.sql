@@ -0,0 +1,4 @@
+ALTER TABLE tasks ADD COLUMN parent_id bigint;
+ALTER TABLE tasks ADD COLUMN auto_complete boolean NOT NULL DEFAULT false;
+ALTER TABLE tasks ADD CONSTRAINT fk_tasks_parent FOREIGN KEY (parent_id) REFERENCES tasks (id) ON DELETE CASCADE;
+CREATE INDEX idx_tasks_parent_id ON tasks (parent_id);
@@ -0,0 +1,11 @@
+CREATE TABLE task_dependencies (
+    task_id bigint NOT NULL,
+    blocker_id bigint NOT NULL,
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (task_id, blocker_id),
+    CONSTRAINT fk_task_dependencies_task FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT fk_task_dependencies_blocker FOREIGN KEY (blocker_id) REFERENCES tasks (id) ON DELETE CASCADE,
+    CONSTRAINT chk_task_dependencies_not_self CHECK (task_id <> blocker_id)
+);
+
+CREATE INDEX idx_task_dependencies_blocker_id ON task_dependencies (blocker_id);
@@ -0,0 +1 @@
+CREATE INDEX idx_login_failures_last_failed_at ON login_failures (last_failed_at);
@@ -0,0 +1,3 @@
+DELETE FROM user_token_revocations WHERE user_id NOT IN (SELECT id FROM users);
+ALTER TABLE user_token_revocations
+    ADD CONSTRAINT fk_user_token_revocations_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+-- Revoking a deleted user's tokens has to outlive the user row.
+ALTER TABLE user_token_revocations DROP CONSTRAINT IF EXISTS fk_user_token_revocations_user;
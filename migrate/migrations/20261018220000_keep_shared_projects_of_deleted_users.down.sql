@@ -0,0 +1,5 @@
+DELETE FROM projects WHERE user_id IS NULL;
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS fk_projects_user;
+ALTER TABLE projects
+    ADD CONSTRAINT fk_projects_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE projects ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,5 @@
+-- Projects shared with others outlive their creator's account.
+ALTER TABLE projects ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE projects DROP CONSTRAINT fk_projects_user;
+ALTER TABLE projects
+    ADD CONSTRAINT fk_projects_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS chk_tasks_user_or_project;
+DELETE FROM tasks WHERE user_id IS NULL;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS fk_tasks_user;
+ALTER TABLE tasks
+    ADD CONSTRAINT fk_tasks_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+ALTER TABLE tasks ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Tasks in projects outlive their creator's account. Tasks outside any
+-- project still need one.
+ALTER TABLE tasks ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE tasks DROP CONSTRAINT fk_tasks_user;
+ALTER TABLE tasks
+    ADD CONSTRAINT fk_tasks_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE tasks
+    ADD CONSTRAINT chk_tasks_user_or_project CHECK (user_id IS NOT NULL OR project_id IS NOT NULL);
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrating, so concurrent
+// deploys run one after another instead of racing on the same schema.
+const lockKey int64 = 0x676f72657374 // "gorest"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads every <version>_<name>.(up|down).sql file in fsys,
+// ordered by version. Each version needs both an up and a down file.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected file in migrations directory: %s", entry.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(body)
+		} else {
+			mig.down = string(body)
+		}
+	}
+	migrations := []migration{}
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", mig.version, mig.name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// createMigration writes a placeholder up/down pair named after the current time.
+func createMigration(dir string, name string, now time.Time) ([]string, error) {
+	prefix := now.UTC().Format("20060102150405") + "_" + name
+	if !migrationFile.MatchString(prefix + ".up.sql") {
+		return nil, fmt.Errorf("invalid migration name %q: use lowercase letters, digits and underscores", name)
+	}
+	paths := []string{}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, prefix+"."+direction+".sql")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fmt.Fprintf(f, "-- %s migration for %s\n", direction, name)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+type runner struct {
+	conn       *sql.Conn
+	migrations []migration
+}
+
+// lock takes the advisory lock on the runner's connection and returns the
+// function releasing it. Every statement must go through r.conn so it runs
+// in the session that holds the lock.
+func (r *runner) lock(ctx context.Context) (func(), error) {
+	if _, err := r.conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return nil, err
+	}
+	if _, err := r.conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		r.unlock()
+		return nil, err
+	}
+	return r.unlock, nil
+}
+
+func (r *runner) unlock() {
+	// Use a fresh context so the lock is released even if ctx was cancelled.
+	r.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+}
+
+func (r *runner) applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := r.conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// run executes one migration's SQL and records it in schema_migrations
+// within a single transaction, so a failing migration leaves no trace.
+func (r *runner) run(ctx context.Context, mig migration, up bool) error {
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	body := mig.down
+	if up {
+		body = mig.up
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", mig.version, mig.name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.version, mig.name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *runner) up(ctx context.Context, w io.Writer) error {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range r.migrations {
+		if _, ok := applied[mig.version]; ok {
+			continue
+		}
+		if err := r.run(ctx, mig, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "applied %d_%s\n", mig.version, mig.name)
+	}
+	return nil
+}
+
+// down reverts the n most recently applied migrations.
+func (r *runner) down(ctx context.Context, w io.Writer, n int) error {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return err
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if n > len(versions) {
+		n = len(versions)
+	}
+	for _, version := range versions[:n] {
+		mig, ok := r.find(version)
+		if !ok {
+			return fmt.Errorf("no migration file for applied version %d", version)
+		}
+		if err := r.run(ctx, mig, false); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "reverted %d_%s\n", mig.version, mig.name)
+	}
+	return nil
+}
+
+func (r *runner) status(ctx context.Context, w io.Writer) error {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range r.migrations {
+		state := "pending"
+		if appliedAt, ok := applied[mig.version]; ok {
+			state = "applied " + appliedAt.Format(time.RFC3339)
+			delete(applied, mig.version)
+		}
+		fmt.Fprintf(w, "%d_%s\t%s\n", mig.version, mig.name, state)
+	}
+	for version := range applied {
+		fmt.Fprintf(w, "%d\tapplied, but no migration file\n", version)
+	}
+	return nil
+}
+
+// force rewrites schema_migrations so exactly the migrations up to and
+// including version count as applied, without running any SQL. It is meant
+// for baselining an existing database or recovering from a manual fix.
+func (r *runner) force(ctx context.Context, version int64) error {
+	if version != 0 {
+		if _, ok := r.find(version); !ok {
+			return fmt.Errorf("no migration with version %d", version)
+		}
+	}
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return err
+	}
+	for _, mig := range r.migrations {
+		if mig.version > version {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.version, mig.name); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *runner) find(version int64) (migration, bool) {
+	for _, mig := range r.migrations {
+		if mig.version == version {
+			return mig, true
+		}
+	}
+	return migration{}, false
+}
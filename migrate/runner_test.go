@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestLoadMigrationsOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20230102000000_add_tags.up.sql":   {Data: []byte("CREATE TABLE tags ();")},
+		"20230102000000_add_tags.down.sql": {Data: []byte("DROP TABLE tags;")},
+		"0001_init.up.sql":                 {Data: []byte("CREATE TABLE users ();")},
+		"0001_init.down.sql":               {Data: []byte("DROP TABLE users;")},
+	}
+	migrations, err := loadMigrations(fsys)
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].version)
+	assert.Equal(t, "init", migrations[0].name)
+	assert.Equal(t, "DROP TABLE tags;", migrations[1].down)
+}
+
+func TestLoadMigrationsRequiresBothDirections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_init.up.sql": {Data: []byte("CREATE TABLE users ();")},
+	}
+	_, err := loadMigrations(fsys)
+	assert.Error(t, err)
+}
+
+func TestLoadMigrationsRejectsUnknownFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.md": {Data: []byte("")},
+	}
+	_, err := loadMigrations(fsys)
+	assert.Error(t, err)
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2023, 8, 1, 12, 30, 0, 0, time.UTC)
+	paths, err := createMigration(dir, "add_projects", now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "20230801123000_add_projects.up.sql"),
+		filepath.Join(dir, "20230801123000_add_projects.down.sql"),
+	}, paths)
+	migrations, err := loadMigrations(os.DirFS(dir))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20230801123000), migrations[0].version)
+
+	_, err = createMigration(dir, "Bad Name", now)
+	assert.Error(t, err)
+}
+
+func TestRepositoryMigrationsLoad(t *testing.T) {
+	migrations, err := loadMigrations(os.DirFS("migrations"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+}
+
+// newTestDB creates an empty schema in the Postgres database at
+// TEST_DATABASE_URL, a postgres:// URL, and drops it after the test. Tests
+// needing it are skipped when the variable is unset.
+func newTestDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	config := &gorm.Config{TranslateError: true, Logger: gormlogger.Discard}
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	require.NoError(t, err)
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	require.NoError(t, admin.Exec("CREATE SCHEMA "+schema).Error)
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	db, err := gorm.Open(postgres.Open(u.String()), config)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// baselineUser and baselineTask are the models GORM's AutoMigrate created the
+// schema from before there were migrations.
+type baselineUser struct {
+	ID        uint64    `gorm:"primary_key"`
+	Email     string    `gorm:"size:255;not null;unique"`
+	Password  string    `gorm:"size:100;not null;"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdateAt  time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineTask struct {
+	ID        uint64       `gorm:"primary_key"`
+	Title     string       `gorm:"size:255;not null;unique"`
+	CreatedAt time.Time    `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdateAt  time.Time    `gorm:"default:CURRENT_TIMESTAMP"`
+	User      baselineUser `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE"`
+	UserID    uint64       `gorm:"not null"`
+}
+
+func (baselineTask) TableName() string { return "tasks" }
+
+func TestUpMigratesBaselineAutoMigrateSchema(t *testing.T) {
+	dbConn := newTestDB(t)
+	require.NoError(t, dbConn.AutoMigrate(&baselineUser{}, &baselineTask{}))
+	require.NoError(t, dbConn.Exec("INSERT INTO users (email, password) VALUES ('test@example.com', 'hash')").Error)
+	require.NoError(t, dbConn.Exec("INSERT INTO tasks (title, user_id) SELECT 'baseline task', id FROM users").Error)
+	migrations, err := loadMigrations(os.DirFS("migrations"))
+	require.NoError(t, err)
+
+	require.NoError(t, run(dbConn, migrations, "up", 0))
+	task := struct {
+		Status   string
+		Priority string
+		Version  uint64
+	}{}
+	require.NoError(t, dbConn.Raw("SELECT status, priority, version FROM tasks WHERE title = 'baseline task'").Scan(&task).Error)
+	assert.Equal(t, "todo", task.Status)
+	assert.Equal(t, "medium", task.Priority)
+	assert.Equal(t, uint64(1), task.Version)
+	require.NoError(t, run(dbConn, migrations, "down", int64(len(migrations))))
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// RecoveryCode stores the hash of a one-time code that stands in for a TOTP
+// code when the user has lost their authenticator.
+type RecoveryCode struct {
+	ID        uint64     `gorm:"primary_key" json:"id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	User      User       `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint64     `gorm:"not null;index" json:"user_id"`
+}
+
+// LoginResult is what a correct password earns: a token pair, or for
+// accounts with two-factor authentication, a challenge to answer at
+// POST /login/mfa.
+type LoginResult struct {
+	Tokens    TokenPair
+	Challenge *MFAChallenge
+}
+
+type MFAChallenge struct {
+	MFAToken  string    `json:"mfa_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MFAVerification is the body of POST /login/mfa. Code is a TOTP code or a
+// recovery code.
+type MFAVerification struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAConfirmation proves both factors before two-factor settings change.
+type MFAConfirmation struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
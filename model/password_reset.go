@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// PasswordResetToken stores the hash of an emailed reset token. It can be
+// used once, before ExpiresAt.
+type PasswordResetToken struct {
+	ID        uint64     `gorm:"primary_key" json:"id"`
+	TokenHash string     `gorm:"size:64;not null;unique" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	User      User       `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint64     `gorm:"not null;index" json:"user_id"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+const (
+	ProjectTasksMove   = "move"
+	ProjectTasksDelete = "delete"
+)
+
+type Project struct {
+	ID          uint64    `gorm:"primary_key" json:"id"`
+	Name        string    `gorm:"size:100;not null;index:idx_projects_user_id_lower_name,unique,expression:lower(name),priority:2" json:"name"`
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdateAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	User        *User     `gorm:"foreignkey:UserID; constraint:OnDelete:SET NULL" json:"user,omitempty"`
+	// UserID is the project's creator, or nil once they deleted their account
+	// and left the project to its other members.
+	UserID *uint64 `gorm:"index:idx_projects_user_id_lower_name,unique,priority:1" json:"user_id"`
+	// OpenTaskCount and DoneTaskCount are computed when projects are read.
+	// Open means todo or in progress; archived tasks count as neither.
+	OpenTaskCount int64 `gorm:"->;-:migration" json:"-"`
+	DoneTaskCount int64 `gorm:"->;-:migration" json:"-"`
+	// Role is the reading user's role in the project.
+	Role string `gorm:"->;-:migration" json:"-"`
+}
+
+type ProjectResponse struct {
+	ID            uint64    `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Role          string    `json:"role"`
+	OpenTaskCount int64     `json:"open_task_count"`
+	DoneTaskCount int64     `json:"done_task_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdateAt      time.Time `json:"updated_at"`
+}
+
+// ProjectDeletion says what happens to a deleted project's tasks: they are
+// moved to the project MoveTo, or out of any project when it is 0, or deleted
+// along with the project.
+type ProjectDeletion struct {
+	Tasks  string `json:"tasks"`
+	MoveTo uint64 `json:"move_to"`
+}
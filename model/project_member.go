@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+const (
+	ProjectRoleOwner  = "owner"
+	ProjectRoleEditor = "editor"
+	ProjectRoleViewer = "viewer"
+)
+
+// ProjectMember gives a user access to a project and every task in it.
+// Viewers can read, editors can also change tasks, and owners can also
+// manage the project and its members.
+type ProjectMember struct {
+	ProjectID uint64    `gorm:"primaryKey;autoIncrement:false" json:"project_id"`
+	Project   Project   `gorm:"foreignkey:ProjectID; constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint64    `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`
+	User      User      `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"-"`
+	Role      string    `gorm:"size:20;not null" json:"role"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+type ProjectMemberResponse struct {
+	UserID    uint64    `json:"user_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProjectInvitation is the body of POST /projects/:projectId/members.
+type ProjectInvitation struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RateLimitBucket is a token bucket: Tokens is the count at UpdatedAt, and it
+// refills continuously from there up to the limit's burst.
+type RateLimitBucket struct {
+	Key       string    `gorm:"primary_key;size:255" json:"key"`
+	Tokens    float64   `gorm:"not null" json:"tokens"`
+	UpdatedAt time.Time `gorm:"not null;index" json:"updated_at"`
+}
+
+// LoginFailure counts consecutive failed logins for one account.
+type LoginFailure struct {
+	Key          string    `gorm:"primary_key;size:255" json:"key"`
+	Count        int       `gorm:"not null" json:"count"`
+	LastFailedAt time.Time `gorm:"not null;index" json:"last_failed_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// RevokedToken records an access token that was logged out before it expired.
+type RevokedToken struct {
+	JTI       string    `gorm:"primary_key;size:64" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// UserTokenRevocation invalidates every access token a user was issued before
+// RevokedBefore. Like AccountDeletion it holds no foreign key, so it outlives
+// a deleted user and keeps their tokens revoked.
+type UserTokenRevocation struct {
+	UserID        uint64    `gorm:"primary_key" json:"user_id"`
+	RevokedBefore time.Time `gorm:"not null" json:"revoked_before"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Session is one refresh token issued to a user. Tokens rotated from the same
+// login share a FamilyID so the whole chain can be revoked at once.
+type Session struct {
+	ID        uint64     `gorm:"primary_key" json:"id"`
+	FamilyID  string     `gorm:"size:64;not null;index" json:"family_id"`
+	TokenHash string     `gorm:"size:64;not null;unique" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	User      User       `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint64     `gorm:"not null;index" json:"user_id"`
+}
+
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
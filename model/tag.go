@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// Tag labels tasks. Each user has their own tags, named uniquely regardless
+// of case.
+type Tag struct {
+	ID        uint64    `gorm:"primary_key" json:"id"`
+	Name      string    `gorm:"size:30;not null;index:idx_tags_user_id_lower_name,unique,expression:lower(name),priority:2" json:"name"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdateAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	User      User      `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"user"`
+	UserID    uint64    `gorm:"not null;index:idx_tags_user_id_lower_name,unique,priority:1" json:"user_id"`
+}
+
+type TagResponse struct {
+	ID        uint64    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdateAt  time.Time `json:"updated_at"`
+}
@@ -2,18 +2,111 @@ package model
 
 import "time"
 
+const (
+	TaskStatusTodo       = "todo"
+	TaskStatusInProgress = "in_progress"
+	TaskStatusDone       = "done"
+	TaskStatusArchived   = "archived"
+)
+
+// TaskEmbedSubtasks asks for each listed task's subtasks to be embedded.
+const TaskEmbedSubtasks = "subtasks"
+
+const (
+	TaskPriorityLow    = "low"
+	TaskPriorityMedium = "medium"
+	TaskPriorityHigh   = "high"
+	TaskPriorityUrgent = "urgent"
+)
+
 type Task struct {
-	ID        uint64    `gorm:"primary_key" json:"id"`
-	Title     string    `gorm:"size:255;not null;unique" json:"title"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdateAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	User      User      `gorm:"foreignkey:UserID; constraint:OnDelete:CASCADE" json:"user"`
-	UserID    uint64    `gorm:"not null" json:"user_id"`
+	ID           uint64     `gorm:"primary_key" json:"id"`
+	Title        string     `gorm:"size:255;not null;index:idx_tasks_user_id_lower_title,unique,expression:lower(title),priority:2" json:"title"`
+	Description  string     `gorm:"type:text;not null;default:''" json:"description"`
+	Status       string     `gorm:"size:20;not null;default:'todo';index" json:"status"`
+	Priority     string     `gorm:"size:20;not null;default:'medium'" json:"priority"`
+	DueDate      *time.Time `json:"due_date"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	Version      uint64     `gorm:"not null;default:1" json:"version"`
+	CreatedAt    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdateAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Project      *Project   `gorm:"foreignkey:ProjectID; constraint:OnDelete:SET NULL" json:"-"`
+	ProjectID    *uint64    `gorm:"index" json:"project_id"`
+	Parent       *Task      `gorm:"foreignkey:ParentID; constraint:OnDelete:CASCADE" json:"-"`
+	ParentID     *uint64    `gorm:"index" json:"parent_id"`
+	Subtasks     []Task     `gorm:"foreignkey:ParentID" json:"-"`
+	AutoComplete bool       `gorm:"not null;default:false" json:"auto_complete"`
+	Tags         []Tag      `gorm:"many2many:task_tags; constraint:OnDelete:CASCADE" json:"-"`
+	User         *User      `gorm:"foreignkey:UserID; constraint:OnDelete:SET NULL" json:"user,omitempty"`
+	// UserID is the task's creator, or nil once they deleted their account
+	// and left the task to the project it is in.
+	UserID *uint64 `gorm:"index:idx_tasks_user_id_lower_title,unique,priority:1" json:"user_id"`
+	// TagNames sets the task's tags by name when it is created or updated;
+	// nil leaves them as they are.
+	TagNames []string `gorm:"-" json:"tags"`
+	// SubtaskCount and DoneSubtaskCount are computed when tasks are read.
+	// Archived subtasks count as neither.
+	SubtaskCount     int64 `gorm:"->;-:migration" json:"-"`
+	DoneSubtaskCount int64 `gorm:"->;-:migration" json:"-"`
 }
 
 type TaskResponse struct {
-	ID        uint64    `json:"id" gorm:"primary_key"`
-	Title     string    `json:"title" gorm:"size:255;not null;unique"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdateAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID           uint64         `json:"id" gorm:"primary_key"`
+	Title        string         `json:"title" gorm:"size:255;not null;unique"`
+	Description  string         `json:"description"`
+	Status       string         `json:"status"`
+	Priority     string         `json:"priority"`
+	DueDate      *time.Time     `json:"due_date"`
+	CompletedAt  *time.Time     `json:"completed_at"`
+	ProjectID    *uint64        `json:"project_id"`
+	ParentID     *uint64        `json:"parent_id"`
+	AutoComplete bool           `json:"auto_complete"`
+	Tags         []string       `json:"tags"`
+	Progress     TaskProgress   `json:"progress"`
+	Subtasks     []TaskResponse `json:"subtasks,omitempty"`
+	Version      uint64         `json:"version"`
+	CreatedAt    time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdateAt     time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TaskProgress counts a task's direct subtasks, leaving out archived ones.
+type TaskProgress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// TaskQuery holds the filtering, sorting and paging options for listing tasks.
+// Zero-valued fields are treated as unset.
+type TaskQuery struct {
+	Cursor      string    `json:"cursor"`
+	Limit       int       `json:"limit"`
+	ProjectID   uint64    `json:"project_id"`
+	ParentID    uint64    `json:"parent_id"`
+	Title       string    `json:"title"`
+	CreatedFrom time.Time `json:"created_from"`
+	CreatedTo   time.Time `json:"created_to"`
+	UpdatedFrom time.Time `json:"updated_from"`
+	UpdatedTo   time.Time `json:"updated_to"`
+	Sort        string    `json:"sort"`
+	Order       string    `json:"order"`
+	Embed       string    `json:"embed"`
+	// Tags keeps tasks carrying any of the tags, or all of them when TagMatch
+	// is "all". Names are compared case-insensitively.
+	Tags     []string `json:"tags"`
+	TagMatch string   `json:"tag_match"`
+}
+
+// TaskCursor is the decoded form of the opaque cursor returned as next_cursor.
+// It remembers the sort it was issued for so it can't be replayed against another ordering.
+type TaskCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    uint64 `json:"id"`
+}
+
+type TaskListResponse struct {
+	Tasks      []TaskResponse `json:"tasks"`
+	NextCursor string         `json:"next_cursor"`
+	TotalCount int64          `json:"total_count"`
 }
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// TaskDependency records that the task is blocked by the blocker: it can't be
+// marked done while the blocker is still open.
+type TaskDependency struct {
+	TaskID    uint64    `gorm:"primaryKey;autoIncrement:false" json:"task_id"`
+	Task      Task      `gorm:"foreignkey:TaskID; constraint:OnDelete:CASCADE" json:"-"`
+	BlockerID uint64    `gorm:"primaryKey;autoIncrement:false;index;check:chk_task_dependencies_not_self,task_id <> blocker_id" json:"blocker_id"`
+	Blocker   Task      `gorm:"foreignkey:BlockerID; constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+type TaskDependencyResponse struct {
+	TaskID    uint64    `json:"task_id"`
+	BlockerID uint64    `json:"blocker_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskDependencyRequest is the body of POST /tasks/:taskId/dependencies.
+type TaskDependencyRequest struct {
+	BlockerID uint64 `json:"blocker_id"`
+}
+
+type TaskGraphNode struct {
+	ID     uint64 `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+}
+
+// TaskGraph is the dependency graph around a task: the tasks it depends on,
+// directly or not, the tasks that depend on it, and the edges between them.
+type TaskGraph struct {
+	Nodes []TaskGraphNode          `json:"nodes"`
+	Edges []TaskDependencyResponse `json:"edges"`
+}
+
+// TaskOrder lists the tasks of a TaskGraph so that every task comes after
+// all of its blockers.
+type TaskOrder struct {
+	Tasks []TaskGraphNode `json:"tasks"`
+}
@@ -3,14 +3,49 @@ package model
 import "time"
 
 type User struct {
-	ID        uint64    `gorm:"primary_key" json:"id"`
-	Email     string    `gorm:"size:255;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;" json:"password"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdateAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID       uint64 `gorm:"primary_key" json:"id"`
+	Email    string `gorm:"size:255;not null;unique" json:"email"`
+	Password string `gorm:"size:255;not null;" json:"password"`
+	// EmailVerifiedAt is nil until the user follows the emailed verification link.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PendingEmail is an address the user asked to move to. It only replaces
+	// Email once it has been verified, so a mistyped address can't lock them out.
+	PendingEmail string `gorm:"size:255;not null;default:''" json:"-"`
+	// TOTPSecret is set when enrollment starts; two-factor authentication is
+	// only on once TOTPEnabledAt is set by confirming a code.
+	TOTPSecret    string     `gorm:"size:64" json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, which can't be used again.
+	TOTPLastStep int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdateAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
 type UserResponse struct {
-	ID    uint64 `json:"id" gorm:"primary_key"`
-	Email string `json:"email" gorm:"size:255;not null;unique"`
+	ID               uint64     `json:"id" gorm:"primary_key"`
+	Email            string     `json:"email" gorm:"size:255;not null;unique"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	PendingEmail     string     `json:"pending_email,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// EmailChange is the body of PATCH /me. The current password is required so
+// a hijacked session can't move the account to another address.
+type EmailChange struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// AccountDeletion records that a user deleted their account. It outlives the
+// user row, so it holds no foreign key.
+type AccountDeletion struct {
+	ID        uint64    `gorm:"primary_key" json:"id"`
+	UserID    uint64    `gorm:"not null;index" json:"user_id"`
+	DeletedAt time.Time `gorm:"not null" json:"deleted_at"`
 }
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IMFARepository interface {
+	// SetTOTPSecret starts enrollment with a new secret, provided two-factor
+	// authentication isn't already on.
+	SetTOTPSecret(ctx context.Context, userId uint64, secret string) error
+	// EnableTOTP turns two-factor authentication on, recording step as used,
+	// and replaces the user's recovery codes with codeHashes.
+	EnableTOTP(ctx context.Context, userId uint64, step int64, codeHashes []string) error
+	// DisableTOTP clears the secret and deletes every recovery code.
+	DisableTOTP(ctx context.Context, userId uint64) error
+	// UseTOTPStep records step as the last accepted code. It returns NotFound
+	// when a code from step or later was already accepted.
+	UseTOTPStep(ctx context.Context, userId uint64, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error
+	// UseRecoveryCode spends the unused code with codeHash, or returns NotFound.
+	UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) IMFARepository {
+	return &mfaRepository{db}
+}
+
+func (mr *mfaRepository) SetTOTPSecret(ctx context.Context, userId uint64, secret string) error {
+	result := mr.db.WithContext(ctx).Model(&model.User{}).Where("id = ? AND totp_enabled_at IS NULL", userId).
+		Updates(map[string]interface{}{"totp_secret": secret, "update_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.Conflict("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+func (mr *mfaRepository) EnableTOTP(ctx context.Context, userId uint64, step int64, codeHashes []string) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&model.User{}).Where("id = ? AND totp_enabled_at IS NULL", userId).
+			Updates(map[string]interface{}{"totp_enabled_at": now, "totp_last_step": step, "update_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.Conflict("two-factor authentication is already enabled")
+		}
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func (mr *mfaRepository) DisableTOTP(ctx context.Context, userId uint64) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userId).
+			Updates(map[string]interface{}{"totp_secret": nil, "totp_enabled_at": nil, "totp_last_step": 0, "update_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (mr *mfaRepository) UseTOTPStep(ctx context.Context, userId uint64, step int64) error {
+	result := mr.db.WithContext(ctx).Model(&model.User{}).Where("id = ? AND totp_last_step < ?", userId, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("totp code already used")
+	}
+	return nil
+}
+
+func (mr *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func (mr *mfaRepository) UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error {
+	result := mr.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("recovery code not found")
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId uint64, codeHashes []string) error {
+	if err := tx.Where("user_id = ?", userId).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]model.RecoveryCode, len(codeHashes))
+	for i, hash := range codeHashes {
+		codes[i] = model.RecoveryCode{UserID: userId, CodeHash: hash}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPasswordResetRepository interface {
+	CreateResetToken(ctx context.Context, token *model.PasswordResetToken) error
+	// ResetPassword spends the unused, unexpired token with tokenHash, sets
+	// its user's password hash and loads that user into user. Every other
+	// outstanding token of the user is discarded.
+	ResetPassword(ctx context.Context, user *model.User, tokenHash string, passwordHash string) error
+}
+
+type passwordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) IPasswordResetRepository {
+	return &passwordResetRepository{db}
+}
+
+func (pr *passwordResetRepository) CreateResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	if err := pr.db.WithContext(ctx).Create(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *passwordResetRepository) ResetPassword(ctx context.Context, user *model.User, tokenHash string, passwordHash string) error {
+	return pr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		token := model.PasswordResetToken{}
+		result := tx.Model(&token).Clauses(clause.Returning{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.NotFound("reset token not found")
+		}
+		if err := tx.Where("user_id = ? AND id <> ?", token.UserID, token.ID).Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Clauses(clause.Returning{}).Where("id = ?", token.UserID).
+			Updates(map[string]interface{}{"password": passwordHash, "update_at": now}).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
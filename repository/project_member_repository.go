@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IProjectMemberRepository interface {
+	// GetRole returns the user's role in the project, or NotFound when the
+	// user isn't a member.
+	GetRole(ctx context.Context, projectId uint, userId uint) (string, error)
+	GetMembers(ctx context.Context, members *[]model.ProjectMemberResponse, projectId uint) error
+	AddMember(ctx context.Context, member *model.ProjectMember) error
+	// RemoveMember refuses to remove the project's last owner.
+	RemoveMember(ctx context.Context, projectId uint, userId uint) error
+}
+
+type projectMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectMemberRepository(db *gorm.DB) IProjectMemberRepository {
+	return &projectMemberRepository{db}
+}
+
+func (mr *projectMemberRepository) GetRole(ctx context.Context, projectId uint, userId uint) (string, error) {
+	member := model.ProjectMember{}
+	if err := mr.db.WithContext(ctx).Where("project_id = ? AND user_id = ?", projectId, userId).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", apperror.NotFound("project not found")
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+func (mr *projectMemberRepository) GetMembers(ctx context.Context, members *[]model.ProjectMemberResponse, projectId uint) error {
+	if err := mr.db.WithContext(ctx).Model(&model.ProjectMember{}).
+		Select("project_members.user_id, users.email, project_members.role, project_members.created_at").
+		Joins("JOIN users ON users.id = project_members.user_id").
+		Where("project_members.project_id = ?", projectId).
+		Order("project_members.created_at, project_members.user_id").
+		Scan(members).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mr *projectMemberRepository) AddMember(ctx context.Context, member *model.ProjectMember) error {
+	if err := mr.db.WithContext(ctx).Omit("Project", "User").Create(member).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("user is already a member of the project")
+		}
+		return err
+	}
+	return nil
+}
+
+func (mr *projectMemberRepository) RemoveMember(ctx context.Context, projectId uint, userId uint) error {
+	return mr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the owner rows so two owners can't remove each other at once.
+		owners := []model.ProjectMember{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("project_id = ? AND role = ?", projectId, model.ProjectRoleOwner).
+			Find(&owners).Error; err != nil {
+			return err
+		}
+		result := tx.Where("project_id = ? AND user_id = ?", projectId, userId).Delete(&model.ProjectMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.NotFound("member not found")
+		}
+		if len(owners) == 1 && owners[0].UserID == uint64(userId) {
+			return apperror.Conflict("the last owner can't leave the project")
+		}
+		return nil
+	})
+}
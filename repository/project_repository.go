@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IProjectRepository reads the projects userId is a member of, and changes
+// only those userId owns.
+type IProjectRepository interface {
+	GetAllProjects(ctx context.Context, projects *[]model.Project, userId uint) error
+	GetProjectByID(ctx context.Context, project *model.Project, userId uint, projectId uint) error
+	CreateProject(ctx context.Context, project *model.Project) error
+	UpdateProject(ctx context.Context, project *model.Project, userId uint, projectId uint) error
+	// DeleteProject removes the project after moving its tasks to the project
+	// moveTo, which userId must be able to edit, or out of any project when
+	// moveTo is nil. With deleteTasks set the tasks are deleted instead.
+	DeleteProject(ctx context.Context, userId uint, projectId uint, deleteTasks bool, moveTo *uint64) error
+}
+
+type projectRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectRepository(db *gorm.DB) IProjectRepository {
+	return &projectRepository{db}
+}
+
+// memberProjects selects the projects userId has one of roles in, or any role when roles is empty.
+func memberProjects(db *gorm.DB, userId uint, roles ...string) *gorm.DB {
+	members := db.Session(&gorm.Session{NewDB: true}).Model(&model.ProjectMember{}).Select("project_id").Where("user_id = ?", userId)
+	if len(roles) > 0 {
+		members = members.Where("role IN ?", roles)
+	}
+	return members
+}
+
+// withTaskCounts selects the projects userId is a member of, along with the
+// user's role and how many of each project's tasks are open and done.
+func withTaskCounts(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Model(&model.Project{}).
+			Select("projects.*, project_members.role AS role, "+
+				"COUNT(tasks.id) FILTER (WHERE tasks.status IN ?) AS open_task_count, "+
+				"COUNT(tasks.id) FILTER (WHERE tasks.status = ?) AS done_task_count",
+				[]string{model.TaskStatusTodo, model.TaskStatusInProgress}, model.TaskStatusDone).
+			Joins("JOIN project_members ON project_members.project_id = projects.id AND project_members.user_id = ?", userId).
+			Joins("LEFT JOIN tasks ON tasks.project_id = projects.id").
+			Group("projects.id, project_members.role")
+	}
+}
+
+func (pr *projectRepository) GetAllProjects(ctx context.Context, projects *[]model.Project, userId uint) error {
+	if err := pr.db.WithContext(ctx).Scopes(withTaskCounts(userId)).Order("projects.id").Find(projects).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *projectRepository) GetProjectByID(ctx context.Context, project *model.Project, userId uint, projectId uint) error {
+	if err := pr.db.WithContext(ctx).Scopes(withTaskCounts(userId)).Where("projects.id = ?", projectId).
+		First(project).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("project not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateProject stores the project with its creator as owner.
+func (pr *projectRepository) CreateProject(ctx context.Context, project *model.Project) error {
+	return pr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(project).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return apperror.Conflict("a project with this name already exists")
+			}
+			return err
+		}
+		owner := model.ProjectMember{ProjectID: project.ID, UserID: *project.UserID, Role: model.ProjectRoleOwner}
+		if err := tx.Omit("Project", "User").Create(&owner).Error; err != nil {
+			return err
+		}
+		project.Role = model.ProjectRoleOwner
+		return nil
+	})
+}
+
+func (pr *projectRepository) UpdateProject(ctx context.Context, project *model.Project, userId uint, projectId uint) error {
+	project.UpdateAt = time.Now()
+	result := pr.db.WithContext(ctx).Model(project).Clauses(clause.Returning{}).
+		Where("id = ? AND id IN (?)", projectId, memberProjects(pr.db, userId, model.ProjectRoleOwner)).
+		Select("name", "description", "update_at").Updates(project)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("a project with this name already exists")
+		}
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("project not found")
+	}
+	return nil
+}
+
+func (pr *projectRepository) DeleteProject(ctx context.Context, userId uint, projectId uint, deleteTasks bool, moveTo *uint64) error {
+	return pr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		project := model.Project{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND id IN (?)", projectId, memberProjects(tx, userId, model.ProjectRoleOwner)).
+			First(&project).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.NotFound("project not found")
+			}
+			return err
+		}
+		if deleteTasks {
+			if err := tx.Where("project_id = ?", projectId).Delete(&model.Task{}).Error; err != nil {
+				return err
+			}
+		} else {
+			if moveTo != nil {
+				// Lock the target so it can't be deleted while tasks move into it.
+				target := model.Project{}
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("id = ? AND id IN (?)", *moveTo, memberProjects(tx, userId, model.ProjectRoleOwner, model.ProjectRoleEditor)).
+					First(&target).Error; err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return apperror.Validation("target project not found", map[string]string{"move_to": "project not found"})
+					}
+					return err
+				}
+			}
+			moved := map[string]interface{}{"project_id": moveTo, "update_at": time.Now(), "version": gorm.Expr("version + 1")}
+			if moveTo == nil {
+				// Tasks whose creator deleted their account go to the owner
+				// taking them out of the project.
+				moved["user_id"] = gorm.Expr("COALESCE(user_id, ?)", userId)
+			}
+			if err := tx.Model(&model.Task{}).Where("project_id = ?", projectId).Updates(moved).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return apperror.Conflict("a task left by a deleted account has the same title as one of yours")
+				}
+				return err
+			}
+		}
+		return tx.Delete(&project).Error
+	})
+}
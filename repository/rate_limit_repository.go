@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// staleBucketAge is how long an idle bucket is kept. Any limit refills well
+// within it, so dropping the bucket is the same as keeping a full one.
+const staleBucketAge = 24 * time.Hour
+
+type IRateLimitRepository interface {
+	// Take removes a token from the bucket named key, which holds up to burst
+	// tokens and regains one every interval. It returns 0 when a token was
+	// taken, or how long until one will be available.
+	Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error)
+	GetFailures(ctx context.Context, failure *model.LoginFailure, key string) error
+	// RecordFailure counts a failed login, starting over when the previous
+	// failure is older than window, and stores the result in failure. Any
+	// failure older than window, for whatever key, is dropped on the way.
+	RecordFailure(ctx context.Context, failure *model.LoginFailure, key string, window time.Duration) error
+	ResetFailures(ctx context.Context, key string) error
+}
+
+type rateLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepository(db *gorm.DB) IRateLimitRepository {
+	return &rateLimitRepository{db}
+}
+
+func (rl *rateLimitRepository) Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error) {
+	var wait time.Duration
+	err := rl.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("updated_at < ?", now.Add(-staleBucketAge)).Delete(&model.RateLimitBucket{}).Error; err != nil {
+			return err
+		}
+		bucket := model.RateLimitBucket{Key: key, Tokens: float64(burst), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bucket).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&bucket).Error; err != nil {
+			return err
+		}
+		wait = takeToken(&bucket, burst, interval, now)
+		return tx.Model(&bucket).Updates(map[string]interface{}{"tokens": bucket.Tokens, "updated_at": bucket.UpdatedAt}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return wait, nil
+}
+
+func (rl *rateLimitRepository) GetFailures(ctx context.Context, failure *model.LoginFailure, key string) error {
+	if err := rl.db.WithContext(ctx).Where("key = ?", key).First(failure).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			*failure = model.LoginFailure{Key: key}
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (rl *rateLimitRepository) RecordFailure(ctx context.Context, failure *model.LoginFailure, key string, window time.Duration) error {
+	now := time.Now()
+	// Keys come from whatever emails are tried, so the table is pruned here
+	// like rate_limit_buckets is in Take.
+	if err := rl.db.WithContext(ctx).Where("last_failed_at < ?", now.Add(-window)).Delete(&model.LoginFailure{}).Error; err != nil {
+		return err
+	}
+	*failure = model.LoginFailure{Key: key, Count: 1, LastFailedAt: now}
+	if err := rl.db.WithContext(ctx).Clauses(clause.Returning{}, clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":          gorm.Expr("CASE WHEN login_failures.last_failed_at < ? THEN 1 ELSE login_failures.count + 1 END", now.Add(-window)),
+			"last_failed_at": now,
+		}),
+	}).Create(failure).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rl *rateLimitRepository) ResetFailures(ctx context.Context, key string) error {
+	if err := rl.db.WithContext(ctx).Where("key = ?", key).Delete(&model.LoginFailure{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+type memoryRateLimitRepository struct {
+	mu            sync.Mutex
+	buckets       map[string]*model.RateLimitBucket
+	failures      map[string]model.LoginFailure
+	swept         time.Time
+	failuresSwept time.Time
+}
+
+// NewMemoryRateLimitRepository returns a process-local store, for tests and
+// single-instance deployments.
+func NewMemoryRateLimitRepository() IRateLimitRepository {
+	return &memoryRateLimitRepository{
+		buckets:       map[string]*model.RateLimitBucket{},
+		failures:      map[string]model.LoginFailure{},
+		swept:         time.Now(),
+		failuresSwept: time.Now(),
+	}
+}
+
+func (mr *memoryRateLimitRepository) Take(ctx context.Context, key string, burst int, interval time.Duration) (time.Duration, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	now := time.Now()
+	if now.Sub(mr.swept) > staleBucketAge {
+		for k, b := range mr.buckets {
+			if now.Sub(b.UpdatedAt) > staleBucketAge {
+				delete(mr.buckets, k)
+			}
+		}
+		mr.swept = now
+	}
+	bucket, ok := mr.buckets[key]
+	if !ok {
+		bucket = &model.RateLimitBucket{Key: key, Tokens: float64(burst), UpdatedAt: now}
+		mr.buckets[key] = bucket
+	}
+	return takeToken(bucket, burst, interval, now), nil
+}
+
+func (mr *memoryRateLimitRepository) GetFailures(ctx context.Context, failure *model.LoginFailure, key string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if f, ok := mr.failures[key]; ok {
+		*failure = f
+	} else {
+		*failure = model.LoginFailure{Key: key}
+	}
+	return nil
+}
+
+func (mr *memoryRateLimitRepository) RecordFailure(ctx context.Context, failure *model.LoginFailure, key string, window time.Duration) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	now := time.Now()
+	if now.Sub(mr.failuresSwept) > window {
+		for k, f := range mr.failures {
+			if now.Sub(f.LastFailedAt) > window {
+				delete(mr.failures, k)
+			}
+		}
+		mr.failuresSwept = now
+	}
+	f := mr.failures[key]
+	if f.Count == 0 || f.LastFailedAt.Before(now.Add(-window)) {
+		f = model.LoginFailure{Key: key}
+	}
+	f.Count++
+	f.LastFailedAt = now
+	mr.failures[key] = f
+	*failure = f
+	return nil
+}
+
+func (mr *memoryRateLimitRepository) ResetFailures(ctx context.Context, key string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	delete(mr.failures, key)
+	return nil
+}
+
+// takeToken refills bucket up to now and takes one token from it if it can,
+// otherwise returning how long until the next token arrives.
+func takeToken(bucket *model.RateLimitBucket, burst int, interval time.Duration, now time.Time) time.Duration {
+	if elapsed := now.Sub(bucket.UpdatedAt); elapsed > 0 {
+		bucket.Tokens += float64(elapsed) / float64(interval)
+	}
+	if bucket.Tokens > float64(burst) {
+		bucket.Tokens = float64(burst)
+	}
+	bucket.UpdatedAt = now
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.Tokens) * float64(interval))
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRecordFailurePrunesOldFailures(t *testing.T) {
+	rl := NewMemoryRateLimitRepository().(*memoryRateLimitRepository)
+	window := 10 * time.Millisecond
+	failure := model.LoginFailure{}
+
+	for _, key := range []string{"login:a@example.com", "login:b@example.com"} {
+		assert.NoError(t, rl.RecordFailure(context.Background(), &failure, key, window))
+	}
+	assert.Len(t, rl.failures, 2)
+	time.Sleep(2 * window)
+	assert.NoError(t, rl.RecordFailure(context.Background(), &failure, "login:c@example.com", window))
+	assert.Len(t, rl.failures, 1)
+	assert.Equal(t, 1, failure.Count)
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IRevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeAllForUser(ctx context.Context, userId uint64, before time.Time) error
+	IsRevoked(ctx context.Context, jti string, userId uint64, issuedAt time.Time) (bool, error)
+}
+
+type revocationRepository struct {
+	db *gorm.DB
+}
+
+func NewRevocationRepository(db *gorm.DB) IRevocationRepository {
+	return &revocationRepository{db}
+}
+
+func (rr *revocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return rr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Entries are only useful until the token would have expired anyway.
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&model.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		token := model.RevokedToken{JTI: jti, ExpiresAt: expiresAt}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&token).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (rr *revocationRepository) RevokeAllForUser(ctx context.Context, userId uint64, before time.Time) error {
+	revocation := model.UserTokenRevocation{UserID: userId, RevokedBefore: before}
+	if err := rr.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before"}),
+	}).Create(&revocation).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rr *revocationRepository) IsRevoked(ctx context.Context, jti string, userId uint64, issuedAt time.Time) (bool, error) {
+	var count int64
+	if err := rr.db.WithContext(ctx).Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+	if err := rr.db.WithContext(ctx).Model(&model.UserTokenRevocation{}).Where("user_id = ? AND revoked_before > ?", userId, issuedAt).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+type memoryRevocationRepository struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	users  map[uint64]time.Time
+}
+
+// NewMemoryRevocationRepository returns a process-local store, intended for tests.
+func NewMemoryRevocationRepository() IRevocationRepository {
+	return &memoryRevocationRepository{
+		tokens: map[string]time.Time{},
+		users:  map[uint64]time.Time{},
+	}
+}
+
+func (mr *memoryRevocationRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	now := time.Now()
+	for id, exp := range mr.tokens {
+		if exp.Before(now) {
+			delete(mr.tokens, id)
+		}
+	}
+	mr.tokens[jti] = expiresAt
+	return nil
+}
+
+func (mr *memoryRevocationRepository) RevokeAllForUser(ctx context.Context, userId uint64, before time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.users[userId] = before
+	return nil
+}
+
+func (mr *memoryRevocationRepository) IsRevoked(ctx context.Context, jti string, userId uint64, issuedAt time.Time) (bool, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.tokens[jti]; ok {
+		return true, nil
+	}
+	before, ok := mr.users[userId]
+	return ok && before.After(issuedAt), nil
+}
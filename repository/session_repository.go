@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSessionUsed is returned by RotateSession when the session was already rotated.
+var ErrSessionUsed = errors.New("session already used")
+
+type ISessionRepository interface {
+	CreateSession(ctx context.Context, session *model.Session) error
+	GetSessionByTokenHash(ctx context.Context, session *model.Session, tokenHash string) error
+	RotateSession(ctx context.Context, current *model.Session, next *model.Session) error
+	RevokeSessionFamily(ctx context.Context, familyId string) error
+	RevokeUserSessions(ctx context.Context, userId uint64) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) ISessionRepository {
+	return &sessionRepository{db}
+}
+
+func (sr *sessionRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	if err := sr.db.WithContext(ctx).Create(session).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *sessionRepository) GetSessionByTokenHash(ctx context.Context, session *model.Session, tokenHash string) error {
+	if err := sr.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("session not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// RotateSession marks current as used and stores next in one transaction.
+// The conditional update makes concurrent rotations of the same token lose with ErrSessionUsed.
+func (sr *sessionRepository) RotateSession(ctx context.Context, current *model.Session, next *model.Session) error {
+	return sr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Session{}).Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", current.ID).Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionUsed
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (sr *sessionRepository) RevokeSessionFamily(ctx context.Context, familyId string) error {
+	if err := sr.db.WithContext(ctx).Model(&model.Session{}).Where("family_id = ? AND revoked_at IS NULL", familyId).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *sessionRepository) RevokeUserSessions(ctx context.Context, userId uint64) error {
+	if err := sr.db.WithContext(ctx).Model(&model.Session{}).Where("user_id = ? AND revoked_at IS NULL", userId).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return nil
+}
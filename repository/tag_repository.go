@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ITagRepository interface {
+	GetAllTags(ctx context.Context, tags *[]model.Tag, userId uint) error
+	GetTagByID(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error
+	CreateTag(ctx context.Context, tag *model.Tag) error
+	UpdateTag(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error
+	DeleteTag(ctx context.Context, userId uint, tagId uint) error
+}
+
+type tagRepository struct {
+	db *gorm.DB
+}
+
+func NewTagRepository(db *gorm.DB) ITagRepository {
+	return &tagRepository{db}
+}
+
+func (tr *tagRepository) GetAllTags(ctx context.Context, tags *[]model.Tag, userId uint) error {
+	if err := tr.db.WithContext(ctx).Where("user_id = ?", userId).Order("lower(name)").Find(tags).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tr *tagRepository) GetTagByID(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error {
+	if err := tr.db.WithContext(ctx).Where("id = ? AND user_id = ?", tagId, userId).First(tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("tag not found")
+		}
+		return err
+	}
+	return nil
+}
+
+func (tr *tagRepository) CreateTag(ctx context.Context, tag *model.Tag) error {
+	if err := tr.db.WithContext(ctx).Create(tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("a tag with this name already exists")
+		}
+		return err
+	}
+	return nil
+}
+
+func (tr *tagRepository) UpdateTag(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error {
+	tag.UpdateAt = time.Now()
+	result := tr.db.WithContext(ctx).Model(tag).Clauses(clause.Returning{}).Where("id = ? AND user_id = ?", tagId, userId).
+		Select("name", "update_at").Updates(tag)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("a tag with this name already exists")
+		}
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("tag not found")
+	}
+	return nil
+}
+
+// DeleteTag deletes the tag and takes it off every task carrying it.
+func (tr *tagRepository) DeleteTag(ctx context.Context, userId uint, tagId uint) error {
+	result := tr.db.WithContext(ctx).Where("id = ? AND user_id = ?", tagId, userId).Delete(&model.Tag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("tag not found")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+
+	"gorm.io/gorm"
+)
+
+// ErrDependencyCycle is returned by AddDependency when the blocker already
+// depends on the task, directly or not.
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// dependencyLockKey names the advisory lock that serializes AddDependency, so
+// two edges added at once can't close a loop that neither sees on its own.
+const dependencyLockKey = 7301001
+
+type ITaskDependencyRepository interface {
+	AddDependency(ctx context.Context, dependency *model.TaskDependency) error
+	RemoveDependency(ctx context.Context, taskId uint, blockerId uint) error
+	// GetOpenBlockerIDs returns the blockers of the task that are todo or in
+	// progress and userId can read, and how many more there are that userId
+	// can't.
+	GetOpenBlockerIDs(ctx context.Context, userId uint, taskId uint) ([]uint64, int64, error)
+	// GetGraph loads the tasks userId can read that the task depends on or
+	// that depend on it, directly or not, the task itself included, and the
+	// dependencies between them.
+	GetGraph(ctx context.Context, tasks *[]model.Task, dependencies *[]model.TaskDependency, userId uint, taskId uint) error
+}
+
+type taskDependencyRepository struct {
+	db *gorm.DB
+}
+
+func NewTaskDependencyRepository(db *gorm.DB) ITaskDependencyRepository {
+	return &taskDependencyRepository{db}
+}
+
+func (dr *taskDependencyRepository) AddDependency(ctx context.Context, dependency *model.TaskDependency) error {
+	return dr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", dependencyLockKey).Error; err != nil {
+			return err
+		}
+		var cycle bool
+		if err := tx.Raw(`WITH RECURSIVE upstream AS (
+			SELECT CAST(? AS bigint) AS id
+			UNION
+			SELECT task_dependencies.blocker_id FROM task_dependencies JOIN upstream ON task_dependencies.task_id = upstream.id
+		) SELECT EXISTS (SELECT 1 FROM upstream WHERE id = ?)`, dependency.BlockerID, dependency.TaskID).Scan(&cycle).Error; err != nil {
+			return err
+		}
+		if cycle {
+			return ErrDependencyCycle
+		}
+		if err := tx.Omit("Task", "Blocker").Create(dependency).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return apperror.Conflict("task is already blocked by this task")
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+func (dr *taskDependencyRepository) RemoveDependency(ctx context.Context, taskId uint, blockerId uint) error {
+	result := dr.db.WithContext(ctx).Where("task_id = ? AND blocker_id = ?", taskId, blockerId).Delete(&model.TaskDependency{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("dependency not found")
+	}
+	return nil
+}
+
+func (dr *taskDependencyRepository) GetOpenBlockerIDs(ctx context.Context, userId uint, taskId uint) ([]uint64, int64, error) {
+	openBlockers := func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN tasks ON tasks.id = task_dependencies.blocker_id").
+			Where("task_dependencies.task_id = ? AND tasks.status IN ?", taskId, []string{model.TaskStatusTodo, model.TaskStatusInProgress})
+	}
+	var total int64
+	if err := dr.db.WithContext(ctx).Model(&model.TaskDependency{}).Scopes(openBlockers).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	ids := []uint64{}
+	if err := dr.db.WithContext(ctx).Model(&model.TaskDependency{}).Scopes(openBlockers, visibleTasks(userId)).
+		Order("task_dependencies.blocker_id").
+		Pluck("task_dependencies.blocker_id", &ids).Error; err != nil {
+		return nil, 0, err
+	}
+	return ids, total - int64(len(ids)), nil
+}
+
+func (dr *taskDependencyRepository) GetGraph(ctx context.Context, tasks *[]model.Task, dependencies *[]model.TaskDependency, userId uint, taskId uint) error {
+	related := []uint64{}
+	if err := dr.db.WithContext(ctx).Raw(`WITH RECURSIVE upstream AS (
+		SELECT CAST(? AS bigint) AS id
+		UNION
+		SELECT task_dependencies.blocker_id FROM task_dependencies JOIN upstream ON task_dependencies.task_id = upstream.id
+	), downstream AS (
+		SELECT CAST(? AS bigint) AS id
+		UNION
+		SELECT task_dependencies.task_id FROM task_dependencies JOIN downstream ON task_dependencies.blocker_id = downstream.id
+	) SELECT id FROM upstream UNION SELECT id FROM downstream`, taskId, taskId).Scan(&related).Error; err != nil {
+		return err
+	}
+	if err := dr.db.WithContext(ctx).Scopes(visibleTasks(userId)).Where("id IN ?", related).Order("id").Find(tasks).Error; err != nil {
+		return err
+	}
+	ids := make([]uint64, len(*tasks))
+	for i, task := range *tasks {
+		ids[i] = task.ID
+	}
+	if err := dr.db.WithContext(ctx).Where("task_id IN ? AND blocker_id IN ?", ids, ids).
+		Order("task_id, blocker_id").Find(dependencies).Error; err != nil {
+		return err
+	}
+	return nil
+}
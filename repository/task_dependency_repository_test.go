@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOpenBlockerIDsOnlyNamesReadableBlockers(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	ur, pr, mr, tr, dr := NewUserRepository(db), NewProjectRepository(db), NewProjectMemberRepository(db), NewTaskRepository(db), NewTaskDependencyRepository(db)
+	alice, bob := model.User{Email: "alice@example.com", Password: "hash"}, model.User{Email: "bob@example.com", Password: "hash"}
+	require.NoError(t, ur.CreateUser(ctx, &alice))
+	require.NoError(t, ur.CreateUser(ctx, &bob))
+	project := model.Project{Name: "shared", UserID: &alice.ID}
+	require.NoError(t, pr.CreateProject(ctx, &project))
+	require.NoError(t, mr.AddMember(ctx, &model.ProjectMember{ProjectID: project.ID, UserID: bob.ID, Role: model.ProjectRoleEditor}))
+	task := model.Task{Title: "ship", UserID: &alice.ID, ProjectID: &project.ID}
+	shared := model.Task{Title: "review", UserID: &alice.ID, ProjectID: &project.ID}
+	private := model.Task{Title: "private", UserID: &alice.ID}
+	for _, tk := range []*model.Task{&task, &shared, &private} {
+		require.NoError(t, tr.CreateTask(ctx, tk))
+	}
+	for _, blocker := range []model.Task{shared, private} {
+		require.NoError(t, dr.AddDependency(ctx, &model.TaskDependency{TaskID: task.ID, BlockerID: blocker.ID}))
+	}
+
+	ids, hidden, err := dr.GetOpenBlockerIDs(ctx, uint(alice.ID), uint(task.ID))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{shared.ID, private.ID}, ids)
+	assert.Zero(t, hidden)
+	ids, hidden, err = dr.GetOpenBlockerIDs(ctx, uint(bob.ID), uint(task.ID))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{shared.ID}, ids)
+	assert.Equal(t, int64(1), hidden)
+}
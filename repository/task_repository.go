@@ -1,59 +1,373 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"go-rest-api/apperror"
 	"go-rest-api/model"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// ErrTaskVersionConflict is returned by UpdateTask when the stored version no longer matches.
+var ErrTaskVersionConflict = errors.New("task version conflict")
+
+// ITaskRepository only reaches the tasks userId may read: their own tasks
+// outside any project, and every task in the projects they are a member of.
+// Whether they may change a task is decided above the repository.
+//
+// Tasks are read with their tags and subtask counts. CreateTask and
+// UpdateTask replace the tags with the task's TagNames unless they are nil,
+// creating the tags the acting user doesn't have yet.
+//
+// Subtasks share their parent's visibility, so whoever can read a task can
+// read all of its subtasks.
 type ITaskRepository interface {
-	GetAllTasks(tasks *[]model.Task, userID uint) error
-	GetTaskByID(task *model.Task, userId uint, taskid uint) error
-	CreateTask(task *model.Task) error
-	UpdateTask(task *model.Task, userId uint, taskId uint) error
-	DeleteTask(userId uint, taskId uint) error
+	GetAllTasks(ctx context.Context, tasks *[]model.Task, total *int64, userID uint, query model.TaskQuery, after *model.TaskCursor) error
+	GetTaskByID(ctx context.Context, task *model.Task, userId uint, taskid uint) error
+	GetSubtasks(ctx context.Context, tasks *[]model.Task, userId uint, taskId uint) error
+	// GetAncestorIDs returns the task's ID followed by those of its parent,
+	// grandparent and so on up to the top-level task.
+	GetAncestorIDs(ctx context.Context, taskId uint) ([]uint64, error)
+	// GetSubtreeHeight returns how many levels of subtasks the task has below it.
+	GetSubtreeHeight(ctx context.Context, taskId uint) (int, error)
+	CreateTask(ctx context.Context, task *model.Task) error
+	// UpdateTask also moves the task's subtasks, at every level, to its project.
+	UpdateTask(ctx context.Context, task *model.Task, userId uint, taskId uint, version uint64) error
+	// CompleteParents marks the task done if it auto-completes and none of its
+	// subtasks or blockers are still open, then does the same for its parent
+	// and so on up.
+	CompleteParents(ctx context.Context, taskId uint) error
+	// DeleteTask deletes the task along with its subtasks at every level.
+	DeleteTask(ctx context.Context, userId uint, taskId uint) error
 }
 
 type taskRepository struct {
 	db *gorm.DB
 }
 
+// taskSortColumns maps the sort keys accepted by the API to their columns.
+var taskSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "update_at",
+	"title":      "title",
+	"id":         "id",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func NewTaskRepository(db *gorm.DB) ITaskRepository {
 	return &taskRepository{db}
 }
 
-func (tr *taskRepository) GetAllTasks(tasks *[]model.Task, userID uint) error {
-	if err := tr.db.Joins("User").Where("user_id = ?", userID).Order("created_at").Find(tasks).Error; err != nil {
+func (tr *taskRepository) GetAllTasks(ctx context.Context, tasks *[]model.Task, total *int64, userID uint, query model.TaskQuery, after *model.TaskCursor) error {
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(visibleTasks(userID))
+		if query.ProjectID != 0 {
+			db = db.Where("project_id = ?", query.ProjectID)
+		}
+		if query.ParentID != 0 {
+			db = db.Where("parent_id = ?", query.ParentID)
+		}
+		if query.Title != "" {
+			db = db.Where("title ILIKE ?", "%"+likeEscaper.Replace(query.Title)+"%")
+		}
+		if !query.CreatedFrom.IsZero() {
+			db = db.Where("created_at >= ?", query.CreatedFrom)
+		}
+		if !query.CreatedTo.IsZero() {
+			db = db.Where("created_at <= ?", query.CreatedTo)
+		}
+		if !query.UpdatedFrom.IsZero() {
+			db = db.Where("update_at >= ?", query.UpdatedFrom)
+		}
+		if !query.UpdatedTo.IsZero() {
+			db = db.Where("update_at <= ?", query.UpdatedTo)
+		}
+		if len(query.Tags) > 0 {
+			db = db.Where("tasks.id IN (?)", taggedTasks(db, userID, query.Tags, query.TagMatch == model.TagMatchAll))
+		}
+		return db
+	}
+	if err := tr.db.WithContext(ctx).Model(&model.Task{}).Scopes(filter).Count(total).Error; err != nil {
+		return err
+	}
+
+	column, ok := taskSortColumns[query.Sort]
+	if !ok {
+		return fmt.Errorf("unsupported sort: %q", query.Sort)
+	}
+	op, dir := ">", "ASC"
+	if query.Order == "desc" {
+		op, dir = "<", "DESC"
+	}
+	page := tr.db.WithContext(ctx).Scopes(filter, withSubtaskCounts)
+	if query.Embed == model.TaskEmbedSubtasks {
+		page = page.Preload("Subtasks", orderSubtasks).Preload("Subtasks.Tags", userTags(userID))
+	}
+	if after != nil {
+		if column == "id" {
+			page = page.Where("id "+op+" ?", after.ID)
+		} else {
+			var value interface{} = after.Value
+			if column != "title" {
+				t, err := time.Parse(time.RFC3339Nano, after.Value)
+				if err != nil {
+					return err
+				}
+				value = t
+			}
+			page = page.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, op), value, after.ID)
+		}
+	}
+	if column != "id" {
+		page = page.Order(column + " " + dir)
+	}
+	if err := page.Order("id "+dir).Limit(query.Limit).Preload("Tags", userTags(userID)).Find(tasks).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-func (tr *taskRepository) GetTaskByID(task *model.Task, userId uint, taskid uint) error {
-	if err := tr.db.Where("id = ?", taskid).First(task, userId, taskid).Error; err != nil {
+func (tr *taskRepository) GetTaskByID(ctx context.Context, task *model.Task, userId uint, taskid uint) error {
+	if err := tr.db.WithContext(ctx).Scopes(visibleTasks(userId), withSubtaskCounts).Where("id = ?", taskid).Preload("Tags", userTags(userId)).First(task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("task not found")
+		}
 		return err
 	}
 	return nil
 }
 
-func (tr *taskRepository) CreateTask(task *model.Task) error {
-	if err := tr.db.Create(task).Error; err != nil {
+func (tr *taskRepository) GetSubtasks(ctx context.Context, tasks *[]model.Task, userId uint, taskId uint) error {
+	if err := tr.db.WithContext(ctx).Scopes(visibleTasks(userId), orderSubtasks).Where("parent_id = ?", taskId).
+		Preload("Tags", userTags(userId)).Find(tasks).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
-func (tr *taskRepository) UpdateTask(task *model.Task, userId uint, taskId uint) error {
-	if err := tr.db.Model(task).Clauses(clause.Returning{}).Where("id = ? AND user_id = ?", taskId, userId).Update("title", task.Title).Error; err != nil {
+func (tr *taskRepository) GetAncestorIDs(ctx context.Context, taskId uint) ([]uint64, error) {
+	ids := []uint64{}
+	// UNION rather than UNION ALL stops the walk should the parents ever loop.
+	if err := tr.db.WithContext(ctx).Raw(`WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, 0 AS level FROM tasks WHERE id = ?
+		UNION
+		SELECT tasks.id, tasks.parent_id, ancestors.level + 1 FROM tasks JOIN ancestors ON tasks.id = ancestors.parent_id
+	) SELECT id FROM ancestors ORDER BY level`, taskId).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (tr *taskRepository) GetSubtreeHeight(ctx context.Context, taskId uint) (int, error) {
+	var height int
+	if err := tr.db.WithContext(ctx).Raw(`WITH RECURSIVE subtree AS (
+		SELECT id, 0 AS level FROM tasks WHERE id = ?
+		UNION
+		SELECT tasks.id, subtree.level + 1 FROM tasks JOIN subtree ON tasks.parent_id = subtree.id
+	) SELECT COALESCE(MAX(level), 0) FROM subtree`, taskId).Scan(&height).Error; err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+func (tr *taskRepository) CreateTask(ctx context.Context, task *model.Task) error {
+	err := tr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Create(task).Error; err != nil {
+			return err
+		}
+		return replaceTags(tx, task, *task.UserID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return tr.titleConflict(ctx, *task.UserID, task.Title, err)
+		}
 		return err
 	}
 	return nil
 }
 
-func (tr *taskRepository) DeleteTask(userId uint, taskId uint) error {
-	if err := tr.db.Where("id = ? AND user_id = ?", taskId, userId).Delete(&model.Task{}).Error; err != nil {
+// UpdateTask writes the task only if its stored version still equals version,
+// bumping the version as part of the same statement.
+func (tr *taskRepository) UpdateTask(ctx context.Context, task *model.Task, userId uint, taskId uint, version uint64) error {
+	task.UpdateAt = time.Now()
+	task.Version = version + 1
+	err := tr.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if task.ProjectID == nil {
+			// Tasks leaving their project without a creator, since they deleted
+			// their account, go to the user taking them out.
+			if err := tx.Exec(`WITH RECURSIVE subtree AS (
+				SELECT id FROM tasks WHERE id = ?
+				UNION
+				SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id
+			) UPDATE tasks SET user_id = ? WHERE id IN (SELECT id FROM subtree) AND user_id IS NULL`, taskId, userId).Error; err != nil {
+				return err
+			}
+		}
+		result := tx.Model(task).Clauses(clause.Returning{}).Scopes(visibleTasks(userId)).Where("id = ? AND version = ?", taskId, version).
+			Select("title", "description", "status", "priority", "due_date", "completed_at", "project_id", "parent_id", "auto_complete", "version", "update_at").
+			Updates(task)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTaskVersionConflict
+		}
+		if err := tx.Exec(`WITH RECURSIVE subtree AS (
+			SELECT id FROM tasks WHERE parent_id = ?
+			UNION
+			SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id
+		) UPDATE tasks SET project_id = ?, version = version + 1, update_at = ?
+		WHERE id IN (SELECT id FROM subtree) AND project_id IS DISTINCT FROM ?`,
+			taskId, task.ProjectID, task.UpdateAt, task.ProjectID).Error; err != nil {
+			return err
+		}
+		return replaceTags(tx, task, uint64(userId))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// Titles are unique per creator, who may be another project member,
+			// or the user themselves when taking a creatorless task out.
+			creator := tr.db.WithContext(ctx).Model(&model.Task{}).Select("COALESCE(user_id, ?)", userId).Where("id = ?", taskId)
+			return tr.titleConflict(ctx, creator, task.Title, err)
+		}
 		return err
 	}
 	return nil
 }
+
+func (tr *taskRepository) CompleteParents(ctx context.Context, taskId uint) error {
+	open := []string{model.TaskStatusTodo, model.TaskStatusInProgress}
+	id := uint64(taskId)
+	for {
+		task := model.Task{}
+		now := time.Now()
+		result := tr.db.WithContext(ctx).Model(&task).Clauses(clause.Returning{}).
+			Where("id = ? AND auto_complete AND status IN ?", id, open).
+			Where("NOT EXISTS (SELECT 1 FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.status IN ?)", open).
+			Where("NOT EXISTS (SELECT 1 FROM task_dependencies JOIN tasks AS blockers ON blockers.id = task_dependencies.blocker_id "+
+				"WHERE task_dependencies.task_id = tasks.id AND blockers.status IN ?)", open).
+			Updates(map[string]interface{}{
+				"status":       model.TaskStatusDone,
+				"completed_at": now,
+				"version":      gorm.Expr("version + 1"),
+				"update_at":    now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || task.ParentID == nil {
+			return nil
+		}
+		id = *task.ParentID
+	}
+}
+
+func (tr *taskRepository) DeleteTask(ctx context.Context, userId uint, taskId uint) error {
+	result := tr.db.WithContext(ctx).Scopes(visibleTasks(userId)).Where("id = ?", taskId).Delete(&model.Task{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("task not found")
+	}
+	return nil
+}
+
+// visibleTasks limits a query to the tasks userId may read.
+func visibleTasks(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("((tasks.project_id IS NULL AND tasks.user_id = ?) OR tasks.project_id IN (?))", userId, memberProjects(db, userId))
+	}
+}
+
+// taggedTasks selects the IDs of the tasks carrying any of userId's tags
+// called names, or all of them with all set.
+func taggedTasks(db *gorm.DB, userId uint, names []string, all bool) *gorm.DB {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	tagged := db.Session(&gorm.Session{NewDB: true}).Table("task_tags").Select("task_tags.task_id").
+		Joins("JOIN tags ON tags.id = task_tags.tag_id").
+		Where("tags.user_id = ? AND lower(tags.name) IN ?", userId, lower)
+	if all {
+		tagged = tagged.Group("task_tags.task_id").Having("COUNT(DISTINCT lower(tags.name)) = ?", len(lower))
+	}
+	return tagged
+}
+
+// withSubtaskCounts selects the tasks along with how many of their direct
+// subtasks there are and how many of those are done.
+func withSubtaskCounts(db *gorm.DB) *gorm.DB {
+	return db.Select("tasks.*, "+
+		"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.status <> ?) AS subtask_count, "+
+		"(SELECT COUNT(*) FROM tasks AS subtasks WHERE subtasks.parent_id = tasks.id AND subtasks.status = ?) AS done_subtask_count",
+		model.TaskStatusArchived, model.TaskStatusDone)
+}
+
+func orderSubtasks(db *gorm.DB) *gorm.DB {
+	return db.Scopes(withSubtaskCounts).Order("tasks.id")
+}
+
+func orderTags(db *gorm.DB) *gorm.DB {
+	return db.Order("lower(tags.name)")
+}
+
+// userTags loads only userId's tags, in order: members of a shared project
+// each tag its tasks their own way.
+func userTags(userId uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("tags.user_id = ?", userId).Scopes(orderTags)
+	}
+}
+
+// replaceTags makes the task's TagNames userId's tags on it, taken from
+// userId's tags and creating those userId doesn't have yet, and loads them
+// into task.Tags. Other users' tags on the task stay. Nil TagNames leave the
+// tags alone.
+func replaceTags(tx *gorm.DB, task *model.Task, userId uint64) error {
+	if task.TagNames == nil {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM task_tags WHERE task_id = ? AND tag_id IN (SELECT id FROM tags WHERE user_id = ?)", task.ID, userId).Error; err != nil {
+		return err
+	}
+	task.Tags = []model.Tag{}
+	if len(task.TagNames) == 0 {
+		return nil
+	}
+	tags := make([]model.Tag, len(task.TagNames))
+	lower := make([]string, len(task.TagNames))
+	for i, name := range task.TagNames {
+		tags[i] = model.Tag{Name: name, UserID: userId}
+		lower[i] = strings.ToLower(name)
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("User").Create(&tags).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, id FROM tags WHERE user_id = ? AND lower(name) IN ?",
+		task.ID, userId, lower).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND lower(name) IN ?", userId, lower).Scopes(orderTags).Find(&task.Tags).Error
+}
+
+// titleConflict looks up the task of userId, a user ID or a subquery selecting
+// one, that already holds title, compared case-insensitively like
+// idx_tasks_user_id_lower_title, and reports its ID.
+func (tr *taskRepository) titleConflict(ctx context.Context, userId interface{}, title string, cause error) error {
+	existing := model.Task{}
+	if err := tr.db.WithContext(ctx).Select("id").Where("user_id = ? AND lower(title) = lower(?)", userId, title).First(&existing).Error; err != nil {
+		return cause
+	}
+	return apperror.ConflictWith(
+		fmt.Sprintf("task %d already has this title", existing.ID),
+		map[string]interface{}{"conflicting_task_id": existing.ID},
+	)
+}
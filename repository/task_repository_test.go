@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTaskTitlesAreUniquePerCreatorIgnoringCase(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	ur, tr := NewUserRepository(db), NewTaskRepository(db)
+	alice, bob := model.User{Email: "alice@example.com", Password: "hash"}, model.User{Email: "bob@example.com", Password: "hash"}
+	require.NoError(t, ur.CreateUser(ctx, &alice))
+	require.NoError(t, ur.CreateUser(ctx, &bob))
+
+	first := model.Task{Title: "Buy milk", UserID: &alice.ID}
+	require.NoError(t, tr.CreateTask(ctx, &first))
+	assert.NoError(t, tr.CreateTask(ctx, &model.Task{Title: "Buy milk", UserID: &bob.ID}))
+	err := tr.CreateTask(ctx, &model.Task{Title: "BUY MILK", UserID: &alice.ID})
+	var appErr *apperror.Error
+	require.True(t, errors.As(err, &appErr), err)
+	assert.Equal(t, apperror.KindConflict, appErr.Kind)
+	assert.Equal(t, first.ID, appErr.Extensions["conflicting_task_id"])
+}
+
+func TestUpdateTaskTitleConflictIsWithTheCreatorsTask(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	ur, pr, mr, tr := NewUserRepository(db), NewProjectRepository(db), NewProjectMemberRepository(db), NewTaskRepository(db)
+	alice, bob := model.User{Email: "alice@example.com", Password: "hash"}, model.User{Email: "bob@example.com", Password: "hash"}
+	require.NoError(t, ur.CreateUser(ctx, &alice))
+	require.NoError(t, ur.CreateUser(ctx, &bob))
+	project := model.Project{Name: "shared", UserID: &alice.ID}
+	require.NoError(t, pr.CreateProject(ctx, &project))
+	require.NoError(t, mr.AddMember(ctx, &model.ProjectMember{ProjectID: project.ID, UserID: bob.ID, Role: model.ProjectRoleEditor}))
+	taken := model.Task{Title: "Buy milk", UserID: &alice.ID}
+	renamed := model.Task{Title: "Buy bread", UserID: &alice.ID, ProjectID: &project.ID}
+	require.NoError(t, tr.CreateTask(ctx, &taken))
+	require.NoError(t, tr.CreateTask(ctx, &renamed))
+	require.NoError(t, tr.CreateTask(ctx, &model.Task{Title: "Buy milk", UserID: &bob.ID}))
+
+	// Bob renames Alice's task, so the title clashes with hers, not his.
+	update := model.Task{Title: "buy MILK", Status: model.TaskStatusTodo, Priority: model.TaskPriorityMedium, ProjectID: &project.ID}
+	err := tr.UpdateTask(ctx, &update, uint(bob.ID), uint(renamed.ID), renamed.Version)
+	var appErr *apperror.Error
+	require.True(t, errors.As(err, &appErr), err)
+	assert.Equal(t, apperror.KindConflict, appErr.Kind)
+	assert.Equal(t, taken.ID, appErr.Extensions["conflicting_task_id"])
+}
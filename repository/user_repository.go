@@ -1,14 +1,36 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"go-rest-api/apperror"
 	"go-rest-api/model"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type IUserRepository interface {
-	GetUserByEmail(user *model.User, email string) error
-	CreateUser(user *model.User) error
+	GetUserByEmail(ctx context.Context, user *model.User, email string) error
+	GetUserByID(ctx context.Context, user *model.User, userId uint64) error
+	CreateUser(ctx context.Context, user *model.User) error
+	// VerifyEmail marks the address as verified, provided it is still the
+	// user's email or pending email. A pending email replaces the old one.
+	VerifyEmail(ctx context.Context, userId uint64, email string) error
+	// SetPendingEmail records the address the user wants to move to, or
+	// cancels the move with an empty email.
+	SetPendingEmail(ctx context.Context, user *model.User, userId uint64, email string) error
+	UpdatePassword(ctx context.Context, userId uint64, passwordHash string) error
+	// CheckDeletable returns a Conflict listing the projects the user is the
+	// last owner of while others are still members.
+	CheckDeletable(ctx context.Context, userId uint64) error
+	// DeleteUser removes the user, and through ON DELETE CASCADE everything
+	// they own, recording the deletion in account_deletions. Projects nobody
+	// else is a member of go with them; the rest stay with their members,
+	// along with the tasks the user created in them. It refuses like
+	// CheckDeletable.
+	DeleteUser(ctx context.Context, userId uint64) error
 }
 
 type userRepository struct {
@@ -19,16 +41,152 @@ func NewUserRepository(dbConn *gorm.DB) IUserRepository {
 	return &userRepository{dbConn}
 }
 
-func (ur *userRepository) GetUserByEmail(user *model.User, email string) error {
-	if err := ur.dbConn.Where("email = ?", email).First(user).Error; err != nil {
+func (ur *userRepository) GetUserByEmail(ctx context.Context, user *model.User, email string) error {
+	if err := ur.dbConn.WithContext(ctx).Where("email = ?", email).First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("user not found")
+		}
 		return err
 	}
 	return nil
 }
 
-func (ur *userRepository) CreateUser(user *model.User) error {
-	if err := ur.dbConn.Create(user).Error; err != nil {
+func (ur *userRepository) GetUserByID(ctx context.Context, user *model.User, userId uint64) error {
+	if err := ur.dbConn.WithContext(ctx).Where("id = ?", userId).First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.NotFound("user not found")
+		}
 		return err
 	}
 	return nil
 }
+
+func (ur *userRepository) CreateUser(ctx context.Context, user *model.User) error {
+	if err := ur.dbConn.WithContext(ctx).Create(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("email is already registered")
+		}
+		return err
+	}
+	return nil
+}
+
+func (ur *userRepository) VerifyEmail(ctx context.Context, userId uint64, email string) error {
+	now := time.Now()
+	// The right-hand sides see the row as it was, so email_verified_at is
+	// only kept when the address stays the same.
+	result := ur.dbConn.WithContext(ctx).Model(&model.User{}).Where("id = ? AND (email = ? OR pending_email = ?)", userId, email, email).
+		Updates(map[string]interface{}{
+			"email":             email,
+			"pending_email":     gorm.Expr("CASE WHEN pending_email = ? THEN '' ELSE pending_email END", email),
+			"email_verified_at": gorm.Expr("CASE WHEN email = ? THEN COALESCE(email_verified_at, ?) ELSE ? END", email, now, now),
+			"update_at":         now,
+		})
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return apperror.Conflict("email is already registered")
+		}
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("user not found")
+	}
+	return nil
+}
+
+func (ur *userRepository) SetPendingEmail(ctx context.Context, user *model.User, userId uint64, email string) error {
+	if email != "" {
+		var taken int64
+		if err := ur.dbConn.WithContext(ctx).Model(&model.User{}).Where("email = ?", email).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return apperror.Conflict("email is already registered")
+		}
+	}
+	result := ur.dbConn.WithContext(ctx).Model(user).Clauses(clause.Returning{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"pending_email": email, "update_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("user not found")
+	}
+	return nil
+}
+
+func (ur *userRepository) UpdatePassword(ctx context.Context, userId uint64, passwordHash string) error {
+	result := ur.dbConn.WithContext(ctx).Model(&model.User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"password": passwordHash, "update_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("user not found")
+	}
+	return nil
+}
+
+func (ur *userRepository) CheckDeletable(ctx context.Context, userId uint64) error {
+	return checkDeletable(ur.dbConn.WithContext(ctx), userId)
+}
+
+// checkDeletable keeps a user from leaving shared projects without an owner.
+func checkDeletable(db *gorm.DB, userId uint64) error {
+	projectIds := []uint64{}
+	if err := db.Model(&model.ProjectMember{}).Where("user_id = ? AND role = ?", userId, model.ProjectRoleOwner).
+		Where("NOT EXISTS (SELECT 1 FROM project_members AS others WHERE others.project_id = project_members.project_id AND others.user_id <> ? AND others.role = ?)", userId, model.ProjectRoleOwner).
+		Where("EXISTS (SELECT 1 FROM project_members AS others WHERE others.project_id = project_members.project_id AND others.user_id <> ?)", userId).
+		Order("project_id").Pluck("project_id", &projectIds).Error; err != nil {
+		return err
+	}
+	if len(projectIds) > 0 {
+		return apperror.ConflictWith("you are the last owner of projects shared with others; hand them over or delete them first",
+			map[string]interface{}{"project_ids": projectIds})
+	}
+	return nil
+}
+
+func (ur *userRepository) DeleteUser(ctx context.Context, userId uint64) error {
+	return ur.dbConn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the user's memberships so the other owners can't leave through
+		// RemoveMember between the check and the delete.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userId).
+			Find(&[]model.ProjectMember{}).Error; err != nil {
+			return err
+		}
+		if err := checkDeletable(tx, userId); err != nil {
+			return err
+		}
+		soloProjectIds := []uint64{}
+		if err := tx.Model(&model.Project{}).Where("id IN (?)", memberProjects(tx, uint(userId))).
+			Where("NOT EXISTS (SELECT 1 FROM project_members AS others WHERE others.project_id = projects.id AND others.user_id <> ?)", userId).
+			Pluck("id", &soloProjectIds).Error; err != nil {
+			return err
+		}
+		if len(soloProjectIds) > 0 {
+			if err := tx.Where("project_id IN ? AND (user_id = ? OR user_id IS NULL)", soloProjectIds, userId).Delete(&model.Task{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", soloProjectIds).Delete(&model.Project{}).Error; err != nil {
+				return err
+			}
+		}
+		// Tasks in the projects that stay lose their creator through ON
+		// DELETE SET NULL; the user's own tasks go with them.
+		if err := tx.Where("user_id = ? AND project_id IS NULL", userId).Delete(&model.Task{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", userId).Delete(&model.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apperror.NotFound("user not found")
+		}
+		if err := tx.Create(&model.AccountDeletion{UserID: userId, DeletedAt: time.Now()}).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
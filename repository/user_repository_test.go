@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteUserKeepsTasksInSharedProjects(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	ur, pr, mr, tr := NewUserRepository(db), NewProjectRepository(db), NewProjectMemberRepository(db), NewTaskRepository(db)
+	creator, member := model.User{Email: "creator@example.com", Password: "hash"}, model.User{Email: "member@example.com", Password: "hash"}
+	require.NoError(t, ur.CreateUser(ctx, &creator))
+	require.NoError(t, ur.CreateUser(ctx, &member))
+	shared, solo := model.Project{Name: "shared", UserID: &creator.ID}, model.Project{Name: "solo", UserID: &creator.ID}
+	require.NoError(t, pr.CreateProject(ctx, &shared))
+	require.NoError(t, pr.CreateProject(ctx, &solo))
+	require.NoError(t, mr.AddMember(ctx, &model.ProjectMember{ProjectID: shared.ID, UserID: member.ID, Role: model.ProjectRoleEditor}))
+	sharedTask := model.Task{Title: "shared work", UserID: &creator.ID, ProjectID: &shared.ID}
+	soloTask := model.Task{Title: "solo work", UserID: &creator.ID, ProjectID: &solo.ID}
+	personalTask := model.Task{Title: "personal", UserID: &creator.ID}
+	for _, task := range []*model.Task{&sharedTask, &soloTask, &personalTask} {
+		require.NoError(t, tr.CreateTask(ctx, task))
+	}
+
+	// The member can't manage the shared project without an owner.
+	assert.Equal(t, apperror.KindConflict, apperror.KindOf(ur.DeleteUser(ctx, creator.ID)))
+	require.NoError(t, db.Model(&model.ProjectMember{}).Where("project_id = ? AND user_id = ?", shared.ID, member.ID).
+		Update("role", model.ProjectRoleOwner).Error)
+	require.NoError(t, ur.DeleteUser(ctx, creator.ID))
+
+	kept := model.Task{}
+	require.NoError(t, tr.GetTaskByID(ctx, &kept, uint(member.ID), uint(sharedTask.ID)))
+	assert.Equal(t, "shared work", kept.Title)
+	assert.Nil(t, kept.UserID)
+	var remaining int64
+	require.NoError(t, db.Model(&model.Task{}).Where("id IN ?", []uint64{soloTask.ID, personalTask.ID}).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+	require.NoError(t, db.Model(&model.Project{}).Where("id = ?", solo.ID).Count(&remaining).Error)
+	assert.Zero(t, remaining)
+}
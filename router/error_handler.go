@@ -0,0 +1,115 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-rest-api/apperror"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const mimeApplicationProblemJSON = "application/problem+json"
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []invalidParam `json:"invalid_params,omitempty"`
+	// Extensions are added as top-level members, as RFC 7807 section 3.2 allows.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p problem) MarshalJSON() ([]byte, error) {
+	type plain problem
+	b, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return b, err
+	}
+	members := map[string]interface{}{}
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+var kindStatus = map[apperror.Kind]int{
+	apperror.KindNotFound:           http.StatusNotFound,
+	apperror.KindConflict:           http.StatusConflict,
+	apperror.KindValidation:         http.StatusBadRequest,
+	apperror.KindUnauthorized:       http.StatusUnauthorized,
+	apperror.KindForbidden:          http.StatusForbidden,
+	apperror.KindPreconditionFailed: http.StatusPreconditionFailed,
+	apperror.KindTooManyRequests:    http.StatusTooManyRequests,
+}
+
+// newHTTPErrorHandler renders every error returned from a handler or
+// middleware as problem+json. Errors that are neither apperror nor echo errors
+// are logged and reported as a bare 500 so internals don't leak to the client.
+func newHTTPErrorHandler(logger *slog.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		p := problem{Type: "about:blank", Status: http.StatusInternalServerError, Instance: c.Request().URL.Path}
+		var appErr *apperror.Error
+		var httpErr *echo.HTTPError
+		switch {
+		case errors.As(err, &appErr):
+			p.Status = kindStatus[appErr.Kind]
+			p.Detail = err.Error()
+			p.Extensions = appErr.Extensions
+			for name, reason := range appErr.Fields {
+				p.InvalidParams = append(p.InvalidParams, invalidParam{Name: name, Reason: reason})
+			}
+			sort.Slice(p.InvalidParams, func(i, j int) bool {
+				return p.InvalidParams[i].Name < p.InvalidParams[j].Name
+			})
+			if appErr.RetryAfter > 0 {
+				seconds := int64(math.Ceil(appErr.RetryAfter.Seconds()))
+				c.Response().Header().Set(echo.HeaderRetryAfter, strconv.FormatInt(seconds, 10))
+			}
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			// The deadline from requestTimeout passed or the client went away.
+			p.Status = http.StatusServiceUnavailable
+			p.Detail = "request timed out"
+			logger.WarnContext(c.Request().Context(), "request timed out", "error", err)
+		case errors.As(err, &httpErr):
+			p.Status = httpErr.Code
+			if p.Status != http.StatusInternalServerError {
+				p.Detail = fmt.Sprint(httpErr.Message)
+			}
+		}
+		if p.Status == http.StatusInternalServerError {
+			logger.ErrorContext(c.Request().Context(), "request failed", "error", err)
+		}
+		p.Title = http.StatusText(p.Status)
+
+		c.Response().Header().Set(echo.HeaderContentType, mimeApplicationProblemJSON)
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(p.Status)
+		} else {
+			err = c.JSON(p.Status, p)
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request().Context(), "failed to write error response", "error", err)
+		}
+	}
+}
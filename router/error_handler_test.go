@@ -0,0 +1,54 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"go-rest-api/apperror"
+	"go-rest-api/controller"
+	"go-rest-api/model"
+	"go-rest-api/usecase"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// conflictingTaskUseCase reports every new task's title as taken by task 5,
+// the way the task repository does, so only the rendering is under test.
+type conflictingTaskUseCase struct {
+	usecase.ITaskUseCase
+}
+
+func (conflictingTaskUseCase) CreateTask(ctx context.Context, task model.Task) (model.TaskResponse, error) {
+	return model.TaskResponse{}, apperror.ConflictWith("task 5 already has this title", map[string]interface{}{"conflicting_task_id": uint64(5)})
+}
+
+func TestCreateTaskTitleConflictIsProblemWithTaskID(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = newHTTPErrorHandler(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tc := controller.NewTaskController(conflictingTaskUseCase{})
+	e.POST("/tasks", tc.CreateTask, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": float64(1)}})
+			return next(c)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"BUY MILK"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, mimeApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+	body := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, float64(409), body["status"])
+	assert.Equal(t, "task 5 already has this title", body["detail"])
+	assert.Equal(t, float64(5), body["conflicting_task_id"])
+}
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/logging"
+	"go-rest-api/repository"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// rejectRevokedTokens must run after the JWT middleware. Tokens without a jti
+// predate server-side revocation and are refused so they can't outlive a logout.
+func rejectRevokedTokens(rr repository.IRevocationRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := c.Get("user").(*jwt.Token)
+			claims := user.Claims.(jwt.MapClaims)
+			jti, _ := claims["jti"].(string)
+			iat, _ := claims["iat"].(float64)
+			userId, _ := claims["user_id"].(float64)
+			if jti == "" {
+				return apperror.Unauthorized("token has been revoked")
+			}
+			issuedAt := time.UnixMilli(int64(iat * 1000))
+			revoked, err := rr.IsRevoked(c.Request().Context(), jti, uint64(userId), issuedAt)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return apperror.Unauthorized("token has been revoked")
+			}
+			return next(c)
+		}
+	}
+}
+
+// logUser tags the request's log lines with the authenticated user. It must
+// run after the JWT middleware.
+func logUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := c.Get("user").(*jwt.Token)
+		claims := user.Claims.(jwt.MapClaims)
+		if userId, ok := claims["user_id"].(float64); ok {
+			logging.SetUserID(c.Request().Context(), uint64(userId))
+		}
+		return next(c)
+	}
+}
+
+// requestTimeout puts a deadline on the request context, which repositories
+// pass on to the database, so a slow query is cancelled instead of holding a
+// connection. A zero timeout disables it.
+func requestTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if timeout <= 0 {
+				return next(c)
+			}
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// limitByIP allows each client IP burst requests to the route at once,
+// regaining one every interval. name keeps routes in separate buckets.
+func limitByIP(rl repository.IRateLimitRepository, name string, burst int, interval time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if burst <= 0 {
+				return next(c)
+			}
+			wait, err := rl.Take(c.Request().Context(), name+":ip:"+c.RealIP(), burst, interval)
+			if err != nil {
+				return err
+			}
+			if wait > 0 {
+				return apperror.TooManyRequests("too many requests", wait)
+			}
+			return next(c)
+		}
+	}
+}
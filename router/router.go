@@ -1,44 +1,129 @@
 package router
 
 import (
+	"go-rest-api/config"
 	"go-rest-api/controller"
+	"go-rest-api/logging"
+	"go-rest-api/metrics"
+	"go-rest-api/repository"
+	"log/slog"
 	"net/http"
-	"os"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func NewRouter(uc controller.IUserController, tc controller.ITaskController) *echo.Echo {
+func NewRouter(cfg config.Config, uc controller.IUserController, tc controller.ITaskController, pc controller.IProjectController, tgc controller.ITagController, hc controller.IHealthController, rr repository.IRevocationRepository, rl repository.IRateLimitRepository, m *metrics.Metrics, logger *slog.Logger) *echo.Echo {
 	e := echo.New()
+	e.HideBanner = true
+	e.IPExtractor = echo.ExtractIPDirect()
+	if cfg.HTTP.TrustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
+	e.HTTPErrorHandler = newHTTPErrorHandler(logger)
+	e.Use(logging.Middleware(logger))
+	e.Use(m.Middleware())
+	e.Use(requestTimeout(cfg.Database.RequestTimeout))
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:3000", os.Getenv("FE_URL")},
+		AllowOrigins: []string{"http://localhost:3000", cfg.HTTP.FrontendURL},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept,
-			echo.HeaderAccessControlAllowHeaders, echo.HeaderXCSRFToken},
-		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE},
+			echo.HeaderAccessControlAllowHeaders, echo.HeaderXCSRFToken, echo.HeaderXRequestID, "If-Match"},
+		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
+		ExposeHeaders:    []string{"ETag", echo.HeaderXRequestID, echo.HeaderRetryAfter},
 		AllowCredentials: true,
 	}))
 	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper:        isOpsEndpoint,
 		CookiePath:     "/",
-		CookieDomain:   os.Getenv("API_DOMAIN"),
+		CookieDomain:   cfg.HTTP.APIDomain,
 		CookieHTTPOnly: true,
 		// CookieSameSite: http.SameSiteDefaultMode,
 		CookieSameSite: http.SameSiteNoneMode,
 	}))
-	e.POST("/signup", uc.SignUp)
-	e.POST("/login", uc.LogIn)
+	e.GET("/healthz", hc.Healthz)
+	e.GET("/readyz", hc.Readyz)
+	e.POST("/signup", uc.SignUp, limitByIP(rl, "signup", cfg.RateLimit.SignUpBurst, cfg.RateLimit.SignUpInterval))
+	e.POST("/login", uc.LogIn, limitByIP(rl, "login", cfg.RateLimit.LoginBurst, cfg.RateLimit.LoginInterval))
+	e.POST("/login/mfa", uc.VerifyMFA, limitByIP(rl, "login", cfg.RateLimit.LoginBurst, cfg.RateLimit.LoginInterval))
+	e.GET("/verify", uc.VerifyEmail)
+	e.POST("/verify/resend", uc.ResendVerification, limitByIP(rl, "verify", cfg.RateLimit.SignUpBurst, cfg.RateLimit.SignUpInterval))
+	e.POST("/password/forgot", uc.ForgotPassword, limitByIP(rl, "password", cfg.RateLimit.SignUpBurst, cfg.RateLimit.SignUpInterval))
+	e.POST("/password/reset", uc.ResetPassword, limitByIP(rl, "password", cfg.RateLimit.SignUpBurst, cfg.RateLimit.SignUpInterval))
+	e.POST("/refresh", uc.Refresh)
 	e.POST("/logout", uc.LogOut)
 	e.GET("/csrf", uc.CsrfToken)
+	auth := []echo.MiddlewareFunc{
+		echojwt.WithConfig(echojwt.Config{
+			SigningKey:  []byte(cfg.Auth.Secret.Value()),
+			TokenLookup: "cookie:token",
+		}),
+		rejectRevokedTokens(rr),
+		logUser,
+	}
+	e.POST("/logout/all", uc.LogOutAll, auth...)
+	me := e.Group("/me")
+	me.Use(auth...)
+	me.GET("", uc.GetMe)
+	me.PATCH("", uc.UpdateMe)
+	me.PUT("/password", uc.ChangePassword)
+	me.DELETE("", uc.DeleteMe)
+	me.POST("/2fa", uc.EnrollTOTP)
+	me.POST("/2fa/confirm", uc.ConfirmTOTP)
+	me.DELETE("/2fa", uc.DisableTOTP)
+	me.POST("/2fa/recovery-codes", uc.RegenerateRecoveryCodes)
 	t := e.Group("/tasks")
-	t.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey:  []byte(os.Getenv("SECRET")),
-		TokenLookup: "cookie:token",
-	}))
+	t.Use(auth...)
 	t.GET("", tc.GetAllTasks)
 	t.GET("/:taskId", tc.GetAllTasksById)
 	t.POST("", tc.CreateTask)
 	t.PUT("/:taskId", tc.UpdateTask)
+	t.PATCH("/:taskId", tc.PatchTask)
 	t.DELETE("/:taskId", tc.DeleteTask)
+	t.GET("/:taskId/subtasks", tc.GetAllTasks)
+	t.POST("/:taskId/subtasks", tc.CreateTask)
+	t.POST("/:taskId/dependencies", tc.AddDependency)
+	t.DELETE("/:taskId/dependencies/:blockerId", tc.RemoveDependency)
+	t.GET("/:taskId/graph", tc.GetTaskGraph)
+	t.GET("/:taskId/graph/order", tc.GetTaskOrder)
+	p := e.Group("/projects")
+	p.Use(auth...)
+	p.GET("", pc.GetAllProjects)
+	p.GET("/:projectId", pc.GetProjectById)
+	p.POST("", pc.CreateProject)
+	p.PUT("/:projectId", pc.UpdateProject)
+	p.DELETE("/:projectId", pc.DeleteProject)
+	p.GET("/:projectId/members", pc.GetMembers)
+	p.POST("/:projectId/members", pc.InviteMember)
+	p.DELETE("/:projectId/members/:userId", pc.RemoveMember)
+	p.GET("/:projectId/tasks", tc.GetAllTasks)
+	p.POST("/:projectId/tasks", tc.CreateTask)
+	tg := e.Group("/tags")
+	tg.Use(auth...)
+	tg.GET("", tgc.GetAllTags)
+	tg.GET("/:tagId", tgc.GetTagById)
+	tg.POST("", tgc.CreateTag)
+	tg.PUT("/:tagId", tgc.UpdateTag)
+	tg.DELETE("/:tagId", tgc.DeleteTag)
 	return e
 }
+
+// NewOpsRouter serves /metrics. It runs on its own listener, see
+// config.ServerConfig.OpsAddr, so the metrics never share the API's port.
+func NewOpsRouter(m *metrics.Metrics) *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/metrics", m.Handler())
+	return e
+}
+
+// isOpsEndpoint reports whether the request is for a health endpoint, which
+// must stay reachable by the orchestrator without cookies or tokens.
+func isOpsEndpoint(c echo.Context) bool {
+	switch c.Path() {
+	case "/healthz", "/readyz":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go-rest-api/config"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Readiness reports whether the process should receive new traffic.
+type Readiness struct {
+	ready atomic.Bool
+}
+
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// Run serves e, and ops on cfg.OpsAddr unless it is nil, until ctx is done,
+// then drains in-flight requests. Readiness is true only between the
+// listeners being bound and shutdown starting.
+func Run(ctx context.Context, e *echo.Echo, ops *echo.Echo, cfg config.ServerConfig, readiness *Readiness) error {
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return err
+	}
+	e.Listener = listener
+	servers := []*echo.Echo{e}
+	if ops != nil {
+		opsListener, err := net.Listen("tcp", cfg.OpsAddr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		ops.Listener = opsListener
+		servers = append(servers, ops)
+	}
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		s.Server.ReadTimeout = cfg.ReadTimeout
+		s.Server.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+		s.Server.WriteTimeout = cfg.WriteTimeout
+		s.Server.IdleTimeout = cfg.IdleTimeout
+		go func(s *echo.Echo) {
+			errc <- s.Start(s.Listener.Addr().String())
+		}(s)
+	}
+	readiness.ready.Store(true)
+
+	select {
+	case err := <-errc:
+		readiness.ready.Store(false)
+		for _, s := range servers {
+			s.Close()
+		}
+		return err
+	case <-ctx.Done():
+	}
+	readiness.ready.Store(false)
+	if cfg.ShutdownDelay > 0 {
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// The API drains first so its last requests still show up in the metrics.
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+	}
+	for range servers {
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	return nil
+}
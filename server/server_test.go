@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"context"
+	"go-rest-api/config"
+	"go-rest-api/server"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDrainsInFlightRequests(t *testing.T) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	started := make(chan struct{})
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return c.String(http.StatusOK, "done")
+	})
+	cfg := config.ServerConfig{Addr: "127.0.0.1:0", ShutdownTimeout: 5 * time.Second}
+	readiness := &server.Readiness{}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx, e, nil, cfg, readiness)
+	}()
+	assert.Eventually(t, readiness.Ready, time.Second, 10*time.Millisecond)
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + e.ListenerAddr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		body <- string(b)
+	}()
+	<-started
+	cancel()
+	assert.Eventually(t, func() bool { return !readiness.Ready() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, <-runErr)
+}
+
+func TestRunServesOpsOnItsOwnListener(t *testing.T) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	ops := echo.New()
+	ops.HideBanner = true
+	ops.HidePort = true
+	ops.GET("/metrics", func(c echo.Context) error {
+		return c.String(http.StatusOK, "metrics")
+	})
+	cfg := config.ServerConfig{Addr: "127.0.0.1:0", OpsAddr: "127.0.0.1:0", ShutdownTimeout: 5 * time.Second}
+	readiness := &server.Readiness{}
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx, e, ops, cfg, readiness)
+	}()
+	assert.Eventually(t, readiness.Ready, time.Second, 10*time.Millisecond)
+
+	res, err := http.Get("http://" + e.ListenerAddr().String() + "/metrics")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, err = http.Get("http://" + ops.ListenerAddr().String() + "/metrics")
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "metrics", string(b))
+	cancel()
+	assert.NoError(t, <-runErr)
+}
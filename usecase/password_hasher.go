@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-rest-api/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, and whether hash was
+	// made with an algorithm or parameters other than the current ones and
+	// should be replaced with a fresh Hash of the password.
+	Verify(hash string, password string) (ok bool, needsRehash bool, err error)
+}
+
+// NewPasswordHasher hashes with the algorithm named in cfg and verifies both
+// bcrypt and argon2id hashes, flagging any hash not made with the current
+// algorithm and parameters for rehashing.
+func NewPasswordHasher(cfg config.PasswordConfig) (PasswordHasher, error) {
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d is outside %d-%d", cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if cfg.Argon2Memory <= 0 || cfg.Argon2Iterations <= 0 || cfg.Argon2Parallelism <= 0 || cfg.Argon2Parallelism > 255 ||
+		cfg.Argon2SaltLength <= 0 || cfg.Argon2KeyLength <= 0 {
+		return nil, errors.New("argon2id parameters must be positive, with parallelism at most 255")
+	}
+	bcryptHasher := &BycryptPasswordHasher{Cost: cfg.BcryptCost}
+	argon2Hasher := &Argon2idPasswordHasher{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+		SaltLength:  uint32(cfg.Argon2SaltLength),
+		KeyLength:   uint32(cfg.Argon2KeyLength),
+	}
+	switch cfg.Algorithm {
+	case "argon2id":
+		return &migratingPasswordHasher{current: argon2Hasher, others: []PasswordHasher{bcryptHasher}}, nil
+	case "bcrypt":
+		return &migratingPasswordHasher{current: bcryptHasher, others: []PasswordHasher{argon2Hasher}}, nil
+	}
+	return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+}
+
+type migratingPasswordHasher struct {
+	current PasswordHasher
+	others  []PasswordHasher
+}
+
+func (mh *migratingPasswordHasher) Hash(password string) (string, error) {
+	return mh.current.Hash(password)
+}
+
+func (mh *migratingPasswordHasher) Verify(hash string, password string) (bool, bool, error) {
+	ok, needsRehash, err := mh.current.Verify(hash, password)
+	if !errors.Is(err, ErrUnknownHashFormat) {
+		return ok, needsRehash, err
+	}
+	for _, other := range mh.others {
+		ok, _, err := other.Verify(hash, password)
+		if errors.Is(err, ErrUnknownHashFormat) {
+			continue
+		}
+		return ok, true, err
+	}
+	return false, false, ErrUnknownHashFormat
+}
+
+type BycryptPasswordHasher struct {
+	Cost int
+}
+
+func (b *BycryptPasswordHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *BycryptPasswordHasher) Verify(hash string, password string) (bool, bool, error) {
+	if !strings.HasPrefix(hash, "$2") {
+		return false, false, ErrUnknownHashFormat
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost != b.Cost, nil
+}
+
+// Argon2idPasswordHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idPasswordHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (a *Argon2idPasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2idPasswordHasher) Verify(hash string, password string) (bool, bool, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return false, false, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2id hash version %q", parts[2])
+	}
+	var params Argon2idPasswordHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, fmt.Errorf("invalid argon2id parameters %q: %w", parts[3], err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return false, false, nil
+	}
+	return true, params != *a, nil
+}
@@ -0,0 +1,88 @@
+package usecase_test
+
+import (
+	"go-rest-api/config"
+	"go-rest-api/usecase"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var passwordConfig = config.PasswordConfig{
+	Algorithm:         "argon2id",
+	BcryptCost:        4,
+	Argon2Memory:      1024,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+}
+
+func TestArgon2idHashRoundTrip(t *testing.T) {
+	hasher, err := usecase.NewPasswordHasher(passwordConfig)
+	require.NoError(t, err)
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, needsRehash, err := hasher.Verify(hash, "password")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _, err = hasher.Verify(hash, "wrong-password")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestArgon2idRehashOnChangedParams(t *testing.T) {
+	hasher, err := usecase.NewPasswordHasher(passwordConfig)
+	require.NoError(t, err)
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+
+	cfg := passwordConfig
+	cfg.Argon2Iterations = 2
+	stronger, err := usecase.NewPasswordHasher(cfg)
+	require.NoError(t, err)
+	ok, needsRehash, err := stronger.Verify(hash, "password")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+}
+
+func TestBcryptHashMigratesToArgon2id(t *testing.T) {
+	cfg := passwordConfig
+	cfg.Algorithm = "bcrypt"
+	bcryptHasher, err := usecase.NewPasswordHasher(cfg)
+	require.NoError(t, err)
+	hash, err := bcryptHasher.Hash("password")
+	require.NoError(t, err)
+
+	hasher, err := usecase.NewPasswordHasher(passwordConfig)
+	require.NoError(t, err)
+	ok, needsRehash, err := hasher.Verify(hash, "password")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+
+	ok, _, err = hasher.Verify(hash, "wrong-password")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyUnknownHashFormat(t *testing.T) {
+	hasher, err := usecase.NewPasswordHasher(passwordConfig)
+	require.NoError(t, err)
+	_, _, err = hasher.Verify("plaintext", "plaintext")
+	assert.ErrorIs(t, err, usecase.ErrUnknownHashFormat)
+}
+
+func TestNewPasswordHasherRejectsUnknownAlgorithm(t *testing.T) {
+	cfg := passwordConfig
+	cfg.Algorithm = "md5"
+	_, err := usecase.NewPasswordHasher(cfg)
+	assert.Error(t, err)
+}
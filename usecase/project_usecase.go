@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"go-rest-api/repository"
+	"go-rest-api/validator"
+)
+
+type IProjectUseCase interface {
+	GetAllProjects(ctx context.Context, userId uint) ([]model.ProjectResponse, error)
+	GetProjectByID(ctx context.Context, userId uint, projectId uint) (model.ProjectResponse, error)
+	CreateProject(ctx context.Context, project model.Project) (model.ProjectResponse, error)
+	UpdateProject(ctx context.Context, project model.Project, userId uint, projectId uint) (model.ProjectResponse, error)
+	DeleteProject(ctx context.Context, userId uint, projectId uint, deletion model.ProjectDeletion) error
+	GetMembers(ctx context.Context, userId uint, projectId uint) ([]model.ProjectMemberResponse, error)
+	InviteMember(ctx context.Context, userId uint, projectId uint, invitation model.ProjectInvitation) (model.ProjectMemberResponse, error)
+	RemoveMember(ctx context.Context, userId uint, projectId uint, memberId uint) error
+}
+
+type projectUseCase struct {
+	pr repository.IProjectRepository
+	mr repository.IProjectMemberRepository
+	ur repository.IUserRepository
+	pv validator.IProjectValidator
+}
+
+var ErrMoveToSameProject = apperror.Validation("tasks can't be moved to the project being deleted", map[string]string{"move_to": "must be another project"})
+
+func NewProjectUseCase(pr repository.IProjectRepository, mr repository.IProjectMemberRepository, ur repository.IUserRepository, pv validator.IProjectValidator) IProjectUseCase {
+	return &projectUseCase{pr, mr, ur, pv}
+}
+
+func (pu *projectUseCase) GetAllProjects(ctx context.Context, userId uint) ([]model.ProjectResponse, error) {
+	projects := []model.Project{}
+	if err := pu.pr.GetAllProjects(ctx, &projects, userId); err != nil {
+		return nil, err
+	}
+	res := []model.ProjectResponse{}
+	for _, project := range projects {
+		res = append(res, newProjectResponse(project))
+	}
+	return res, nil
+}
+
+func (pu *projectUseCase) GetProjectByID(ctx context.Context, userId uint, projectId uint) (model.ProjectResponse, error) {
+	project := model.Project{}
+	if err := pu.pr.GetProjectByID(ctx, &project, userId, projectId); err != nil {
+		return model.ProjectResponse{}, err
+	}
+	return newProjectResponse(project), nil
+}
+
+func (pu *projectUseCase) CreateProject(ctx context.Context, project model.Project) (model.ProjectResponse, error) {
+	if err := pu.pv.ProjectValidate(project); err != nil {
+		return model.ProjectResponse{}, err
+	}
+	if err := pu.pr.CreateProject(ctx, &project); err != nil {
+		return model.ProjectResponse{}, err
+	}
+	return newProjectResponse(project), nil
+}
+
+// UpdateProject renames the project or changes its description; the task
+// counts in the response are read back from the store.
+func (pu *projectUseCase) UpdateProject(ctx context.Context, project model.Project, userId uint, projectId uint) (model.ProjectResponse, error) {
+	if err := pu.pv.ProjectValidate(project); err != nil {
+		return model.ProjectResponse{}, err
+	}
+	if err := pu.pr.UpdateProject(ctx, &project, userId, projectId); err != nil {
+		return model.ProjectResponse{}, err
+	}
+	return pu.GetProjectByID(ctx, userId, projectId)
+}
+
+// DeleteProject deletes the project and, depending on deletion, moves its
+// tasks elsewhere or deletes them with it.
+func (pu *projectUseCase) DeleteProject(ctx context.Context, userId uint, projectId uint, deletion model.ProjectDeletion) error {
+	if deletion.Tasks == "" {
+		deletion.Tasks = model.ProjectTasksMove
+	}
+	if err := pu.pv.ProjectDeletionValidate(deletion); err != nil {
+		return err
+	}
+	if deletion.MoveTo == uint64(projectId) {
+		return ErrMoveToSameProject
+	}
+	var moveTo *uint64
+	if deletion.MoveTo != 0 {
+		moveTo = &deletion.MoveTo
+	}
+	return pu.pr.DeleteProject(ctx, userId, projectId, deletion.Tasks == model.ProjectTasksDelete, moveTo)
+}
+
+func (pu *projectUseCase) GetMembers(ctx context.Context, userId uint, projectId uint) ([]model.ProjectMemberResponse, error) {
+	if err := pu.requireRole(ctx, userId, projectId); err != nil {
+		return nil, err
+	}
+	members := []model.ProjectMemberResponse{}
+	if err := pu.mr.GetMembers(ctx, &members, projectId); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// InviteMember adds the user registered under invitation.Email to the
+// project. Only owners can invite.
+func (pu *projectUseCase) InviteMember(ctx context.Context, userId uint, projectId uint, invitation model.ProjectInvitation) (model.ProjectMemberResponse, error) {
+	if err := pu.pv.ProjectInvitationValidate(invitation); err != nil {
+		return model.ProjectMemberResponse{}, err
+	}
+	if err := pu.requireRole(ctx, userId, projectId, model.ProjectRoleOwner); err != nil {
+		return model.ProjectMemberResponse{}, err
+	}
+	user := model.User{}
+	if err := pu.ur.GetUserByEmail(ctx, &user, invitation.Email); err != nil {
+		return model.ProjectMemberResponse{}, err
+	}
+	member := model.ProjectMember{ProjectID: uint64(projectId), UserID: user.ID, Role: invitation.Role}
+	if err := pu.mr.AddMember(ctx, &member); err != nil {
+		return model.ProjectMemberResponse{}, err
+	}
+	return model.ProjectMemberResponse{
+		UserID:    member.UserID,
+		Email:     user.Email,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt,
+	}, nil
+}
+
+// RemoveMember removes memberId from the project. Owners can remove anyone;
+// other members can only remove themselves.
+func (pu *projectUseCase) RemoveMember(ctx context.Context, userId uint, projectId uint, memberId uint) error {
+	if memberId != userId {
+		if err := pu.requireRole(ctx, userId, projectId, model.ProjectRoleOwner); err != nil {
+			return err
+		}
+	}
+	return pu.mr.RemoveMember(ctx, projectId, memberId)
+}
+
+// requireRole returns ErrProjectNotFound unless the user is a member of the
+// project with one of roles, or with any role when none are given.
+func (pu *projectUseCase) requireRole(ctx context.Context, userId uint, projectId uint, roles ...string) error {
+	role, err := pu.mr.GetRole(ctx, projectId, userId)
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		return ErrProjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return ErrProjectNotFound
+}
+
+func newProjectResponse(project model.Project) model.ProjectResponse {
+	return model.ProjectResponse{
+		ID:            project.ID,
+		Name:          project.Name,
+		Description:   project.Description,
+		OpenTaskCount: project.OpenTaskCount,
+		DoneTaskCount: project.DoneTaskCount,
+		Role:          project.Role,
+		CreatedAt:     project.CreatedAt,
+		UpdateAt:      project.UpdateAt,
+	}
+}
@@ -0,0 +1,179 @@
+package usecase_test
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"go-rest-api/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockProjectRepository struct {
+	mock.Mock
+}
+
+type mockProjectMemberRepository struct {
+	mock.Mock
+}
+
+type mockProjectValidator struct {
+	mock.Mock
+}
+
+func (m *mockProjectRepository) GetAllProjects(ctx context.Context, projects *[]model.Project, userId uint) error {
+	args := m.Called(projects, userId)
+	if args.Get(0) != nil {
+		*projects = args.Get(0).([]model.Project)
+	}
+	return args.Error(1)
+}
+
+func (m *mockProjectRepository) GetProjectByID(ctx context.Context, project *model.Project, userId uint, projectId uint) error {
+	args := m.Called(project, userId, projectId)
+	if args.Get(0) != nil {
+		*project = args.Get(0).(model.Project)
+	}
+	return args.Error(1)
+}
+
+func (m *mockProjectRepository) CreateProject(ctx context.Context, project *model.Project) error {
+	args := m.Called(project)
+	return args.Error(0)
+}
+
+func (m *mockProjectRepository) UpdateProject(ctx context.Context, project *model.Project, userId uint, projectId uint) error {
+	args := m.Called(project, userId, projectId)
+	return args.Error(0)
+}
+
+func (m *mockProjectRepository) DeleteProject(ctx context.Context, userId uint, projectId uint, deleteTasks bool, moveTo *uint64) error {
+	args := m.Called(userId, projectId, deleteTasks, moveTo)
+	return args.Error(0)
+}
+
+func (m *mockProjectMemberRepository) GetRole(ctx context.Context, projectId uint, userId uint) (string, error) {
+	args := m.Called(projectId, userId)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockProjectMemberRepository) GetMembers(ctx context.Context, members *[]model.ProjectMemberResponse, projectId uint) error {
+	args := m.Called(members, projectId)
+	if args.Get(0) != nil {
+		*members = args.Get(0).([]model.ProjectMemberResponse)
+	}
+	return args.Error(1)
+}
+
+func (m *mockProjectMemberRepository) AddMember(ctx context.Context, member *model.ProjectMember) error {
+	args := m.Called(member)
+	return args.Error(0)
+}
+
+func (m *mockProjectMemberRepository) RemoveMember(ctx context.Context, projectId uint, userId uint) error {
+	args := m.Called(projectId, userId)
+	return args.Error(0)
+}
+
+func (m *mockProjectValidator) ProjectValidate(project model.Project) error {
+	args := m.Called(project)
+	return args.Error(0)
+}
+
+func (m *mockProjectValidator) ProjectDeletionValidate(deletion model.ProjectDeletion) error {
+	args := m.Called(deletion)
+	return args.Error(0)
+}
+
+func (m *mockProjectValidator) ProjectInvitationValidate(invitation model.ProjectInvitation) error {
+	args := m.Called(invitation)
+	return args.Error(0)
+}
+
+func TestGetAllProjectsIncludesTaskCounts(t *testing.T) {
+	mockProjectRepo := new(mockProjectRepository)
+	uc := usecase.NewProjectUseCase(mockProjectRepo, new(mockProjectMemberRepository), new(mockUserRepository), new(mockProjectValidator))
+
+	mockProjectRepo.On("GetAllProjects", mock.Anything, uint(1)).Return([]model.Project{{ID: 1, Name: "home", OpenTaskCount: 2, DoneTaskCount: 3}}, nil)
+	projects, err := uc.GetAllProjects(context.Background(), 1)
+	assert.NoError(t, err)
+	if assert.Len(t, projects, 1) {
+		assert.Equal(t, int64(2), projects[0].OpenTaskCount)
+		assert.Equal(t, int64(3), projects[0].DoneTaskCount)
+	}
+}
+
+func TestDeleteProjectKeepsTasksByDefault(t *testing.T) {
+	mockProjectRepo := new(mockProjectRepository)
+	mockProjectValid := new(mockProjectValidator)
+	uc := usecase.NewProjectUseCase(mockProjectRepo, new(mockProjectMemberRepository), new(mockUserRepository), mockProjectValid)
+
+	mockProjectValid.On("ProjectDeletionValidate", model.ProjectDeletion{Tasks: model.ProjectTasksMove}).Return(nil)
+	mockProjectRepo.On("DeleteProject", uint(1), uint(2), false, (*uint64)(nil)).Return(nil)
+	assert.NoError(t, uc.DeleteProject(context.Background(), 1, 2, model.ProjectDeletion{}))
+	mockProjectRepo.AssertExpectations(t)
+}
+
+func TestDeleteProjectMovesOrDeletesTasks(t *testing.T) {
+	mockProjectRepo := new(mockProjectRepository)
+	mockProjectValid := new(mockProjectValidator)
+	uc := usecase.NewProjectUseCase(mockProjectRepo, new(mockProjectMemberRepository), new(mockUserRepository), mockProjectValid)
+	target := uint64(3)
+
+	mockProjectValid.On("ProjectDeletionValidate", mock.Anything).Return(nil)
+	mockProjectRepo.On("DeleteProject", uint(1), uint(2), false, &target).Return(nil)
+	mockProjectRepo.On("DeleteProject", uint(1), uint(2), true, (*uint64)(nil)).Return(nil)
+	assert.NoError(t, uc.DeleteProject(context.Background(), 1, 2, model.ProjectDeletion{Tasks: model.ProjectTasksMove, MoveTo: 3}))
+	assert.NoError(t, uc.DeleteProject(context.Background(), 1, 2, model.ProjectDeletion{Tasks: model.ProjectTasksDelete}))
+	mockProjectRepo.AssertExpectations(t)
+
+	err := uc.DeleteProject(context.Background(), 1, 2, model.ProjectDeletion{Tasks: model.ProjectTasksMove, MoveTo: 2})
+	assert.Equal(t, apperror.KindValidation, apperror.KindOf(err))
+}
+
+func TestInviteMemberRequiresOwner(t *testing.T) {
+	mockMemberRepo := new(mockProjectMemberRepository)
+	mockUserRepo := new(mockUserRepository)
+	mockProjectValid := new(mockProjectValidator)
+	uc := usecase.NewProjectUseCase(new(mockProjectRepository), mockMemberRepo, mockUserRepo, mockProjectValid)
+	invitation := model.ProjectInvitation{Email: "user@test.com", Role: model.ProjectRoleViewer}
+
+	mockProjectValid.On("ProjectInvitationValidate", invitation).Return(nil)
+	mockMemberRepo.On("GetRole", uint(2), uint(1)).Return(model.ProjectRoleEditor, nil)
+	_, err := uc.InviteMember(context.Background(), 1, 2, invitation)
+	assert.Equal(t, usecase.ErrProjectNotFound, err)
+	mockMemberRepo.AssertNotCalled(t, "AddMember", mock.Anything)
+}
+
+func TestInviteMemberAddsUserByEmail(t *testing.T) {
+	mockMemberRepo := new(mockProjectMemberRepository)
+	mockUserRepo := new(mockUserRepository)
+	mockProjectValid := new(mockProjectValidator)
+	uc := usecase.NewProjectUseCase(new(mockProjectRepository), mockMemberRepo, mockUserRepo, mockProjectValid)
+	invitation := model.ProjectInvitation{Email: "user@test.com", Role: model.ProjectRoleEditor}
+
+	mockProjectValid.On("ProjectInvitationValidate", invitation).Return(nil)
+	mockMemberRepo.On("GetRole", uint(2), uint(1)).Return(model.ProjectRoleOwner, nil)
+	mockUserRepo.On("GetUserByEmail", mock.Anything, "user@test.com").Return(model.User{ID: 5, Email: "user@test.com"}, nil)
+	mockMemberRepo.On("AddMember", &model.ProjectMember{ProjectID: 2, UserID: 5, Role: model.ProjectRoleEditor}).Return(nil)
+	member, err := uc.InviteMember(context.Background(), 1, 2, invitation)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), member.UserID)
+	assert.Equal(t, model.ProjectRoleEditor, member.Role)
+}
+
+func TestRemoveMemberAllowsLeaving(t *testing.T) {
+	mockMemberRepo := new(mockProjectMemberRepository)
+	uc := usecase.NewProjectUseCase(new(mockProjectRepository), mockMemberRepo, new(mockUserRepository), new(mockProjectValidator))
+
+	mockMemberRepo.On("RemoveMember", uint(2), uint(1)).Return(nil)
+	assert.NoError(t, uc.RemoveMember(context.Background(), 1, 2, 1))
+	mockMemberRepo.AssertNotCalled(t, "GetRole", mock.Anything, mock.Anything)
+
+	mockMemberRepo.On("GetRole", uint(2), uint(1)).Return(model.ProjectRoleViewer, nil)
+	err := uc.RemoveMember(context.Background(), 1, 2, 5)
+	assert.Equal(t, usecase.ErrProjectNotFound, err)
+	mockMemberRepo.AssertNotCalled(t, "RemoveMember", uint(2), uint(5))
+}
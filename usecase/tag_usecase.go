@@ -0,0 +1,105 @@
+package usecase
+
+import (
+	"context"
+	"go-rest-api/model"
+	"go-rest-api/repository"
+	"go-rest-api/validator"
+	"strings"
+)
+
+type ITagUseCase interface {
+	GetAllTags(ctx context.Context, userId uint) ([]model.TagResponse, error)
+	GetTagByID(ctx context.Context, userId uint, tagId uint) (model.TagResponse, error)
+	CreateTag(ctx context.Context, tag model.Tag) (model.TagResponse, error)
+	UpdateTag(ctx context.Context, tag model.Tag, userId uint, tagId uint) (model.TagResponse, error)
+	DeleteTag(ctx context.Context, userId uint, tagId uint) error
+}
+
+type tagUseCase struct {
+	tr repository.ITagRepository
+	tv validator.ITagValidator
+}
+
+func NewTagUseCase(tr repository.ITagRepository, tv validator.ITagValidator) ITagUseCase {
+	return &tagUseCase{tr, tv}
+}
+
+func (tu *tagUseCase) GetAllTags(ctx context.Context, userId uint) ([]model.TagResponse, error) {
+	tags := []model.Tag{}
+	if err := tu.tr.GetAllTags(ctx, &tags, userId); err != nil {
+		return nil, err
+	}
+	res := []model.TagResponse{}
+	for _, tag := range tags {
+		res = append(res, newTagResponse(tag))
+	}
+	return res, nil
+}
+
+func (tu *tagUseCase) GetTagByID(ctx context.Context, userId uint, tagId uint) (model.TagResponse, error) {
+	tag := model.Tag{}
+	if err := tu.tr.GetTagByID(ctx, &tag, userId, tagId); err != nil {
+		return model.TagResponse{}, err
+	}
+	return newTagResponse(tag), nil
+}
+
+func (tu *tagUseCase) CreateTag(ctx context.Context, tag model.Tag) (model.TagResponse, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := tu.tv.TagValidate(tag); err != nil {
+		return model.TagResponse{}, err
+	}
+	if err := tu.tr.CreateTag(ctx, &tag); err != nil {
+		return model.TagResponse{}, err
+	}
+	return newTagResponse(tag), nil
+}
+
+// UpdateTag renames the tag on every task carrying it.
+func (tu *tagUseCase) UpdateTag(ctx context.Context, tag model.Tag, userId uint, tagId uint) (model.TagResponse, error) {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if err := tu.tv.TagValidate(tag); err != nil {
+		return model.TagResponse{}, err
+	}
+	if err := tu.tr.UpdateTag(ctx, &tag, userId, tagId); err != nil {
+		return model.TagResponse{}, err
+	}
+	return newTagResponse(tag), nil
+}
+
+func (tu *tagUseCase) DeleteTag(ctx context.Context, userId uint, tagId uint) error {
+	if err := tu.tr.DeleteTag(ctx, userId, tagId); err != nil {
+		return err
+	}
+	return nil
+}
+
+func newTagResponse(tag model.Tag) model.TagResponse {
+	return model.TagResponse{
+		ID:        tag.ID,
+		Name:      tag.Name,
+		CreatedAt: tag.CreatedAt,
+		UpdateAt:  tag.UpdateAt,
+	}
+}
+
+// normalizeTagNames trims the names and drops repeats, which differ only in
+// case. Nil stays nil so that it keeps meaning "leave the tags alone".
+func normalizeTagNames(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	res := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, name)
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package usecase_test
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"go-rest-api/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockTagRepository struct {
+	mock.Mock
+}
+
+type mockTagValidator struct {
+	mock.Mock
+}
+
+func (m *mockTagRepository) GetAllTags(ctx context.Context, tags *[]model.Tag, userId uint) error {
+	args := m.Called(tags, userId)
+	if args.Get(0) != nil {
+		*tags = args.Get(0).([]model.Tag)
+	}
+	return args.Error(1)
+}
+
+func (m *mockTagRepository) GetTagByID(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error {
+	args := m.Called(tag, userId, tagId)
+	return args.Error(0)
+}
+
+func (m *mockTagRepository) CreateTag(ctx context.Context, tag *model.Tag) error {
+	args := m.Called(tag)
+	return args.Error(0)
+}
+
+func (m *mockTagRepository) UpdateTag(ctx context.Context, tag *model.Tag, userId uint, tagId uint) error {
+	args := m.Called(tag, userId, tagId)
+	return args.Error(0)
+}
+
+func (m *mockTagRepository) DeleteTag(ctx context.Context, userId uint, tagId uint) error {
+	args := m.Called(userId, tagId)
+	return args.Error(0)
+}
+
+func (m *mockTagValidator) TagValidate(tag model.Tag) error {
+	args := m.Called(tag)
+	return args.Error(0)
+}
+
+func TestCreateTagTrimsName(t *testing.T) {
+	mockTagRepo := new(mockTagRepository)
+	mockTagValid := new(mockTagValidator)
+	uc := usecase.NewTagUseCase(mockTagRepo, mockTagValid)
+
+	mockTagValid.On("TagValidate", model.Tag{Name: "bug", UserID: 1}).Return(nil)
+	mockTagRepo.On("CreateTag", &model.Tag{Name: "bug", UserID: 1}).Return(nil)
+	res, err := uc.CreateTag(context.Background(), model.Tag{Name: "  bug ", UserID: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "bug", res.Name)
+}
+
+func TestUpdateTagRejectsInvalidName(t *testing.T) {
+	mockTagRepo := new(mockTagRepository)
+	mockTagValid := new(mockTagValidator)
+	uc := usecase.NewTagUseCase(mockTagRepo, mockTagValid)
+
+	mockTagValid.On("TagValidate", mock.Anything).Return(apperror.Validation("validation failed", map[string]string{"name": "tag name is required"}))
+	_, err := uc.UpdateTag(context.Background(), model.Tag{Name: " "}, 1, 2)
+	assert.Equal(t, apperror.KindValidation, apperror.KindOf(err))
+	mockTagRepo.AssertNotCalled(t, "UpdateTag", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/model"
+	"go-rest-api/repository"
+)
+
+// ErrTaskNotFound and ErrProjectNotFound are also returned when the resource
+// exists but the caller may not use it, so its existence doesn't leak.
+var (
+	ErrTaskNotFound    = apperror.NotFound("task not found")
+	ErrProjectNotFound = apperror.NotFound("project not found")
+)
+
+type taskAuthorizer struct {
+	next ITaskUseCase
+	tr   repository.ITaskRepository
+	mr   repository.IProjectMemberRepository
+}
+
+// NewTaskAuthorizer checks that the caller may read or change the tasks in a
+// call before passing it on to next. Tasks outside any project belong to
+// their creator alone; tasks in a project follow the caller's role in it.
+func NewTaskAuthorizer(next ITaskUseCase, tr repository.ITaskRepository, mr repository.IProjectMemberRepository) ITaskUseCase {
+	return &taskAuthorizer{next, tr, mr}
+}
+
+func (ta *taskAuthorizer) GetAllTasks(ctx context.Context, userId uint, query model.TaskQuery) (model.TaskListResponse, error) {
+	if query.ProjectID != 0 {
+		if _, err := ta.projectRole(ctx, userId, uint(query.ProjectID)); err != nil {
+			return model.TaskListResponse{}, err
+		}
+	}
+	if query.ParentID != 0 {
+		parent := model.Task{}
+		if err := ta.tr.GetTaskByID(ctx, &parent, userId, uint(query.ParentID)); err != nil {
+			return model.TaskListResponse{}, err
+		}
+	}
+	return ta.next.GetAllTasks(ctx, userId, query)
+}
+
+// GetTaskByID needs no check of its own: any role may read, and the
+// repository never returns tasks the caller can't see.
+func (ta *taskAuthorizer) GetTaskByID(ctx context.Context, userId uint, taskId uint) (model.TaskResponse, error) {
+	return ta.next.GetTaskByID(ctx, userId, taskId)
+}
+
+// CreateTask is checked by the use case itself, which only accepts projects
+// and parent tasks the caller can edit.
+func (ta *taskAuthorizer) CreateTask(ctx context.Context, task model.Task) (model.TaskResponse, error) {
+	return ta.next.CreateTask(ctx, task)
+}
+
+func (ta *taskAuthorizer) UpdateTask(ctx context.Context, task model.Task, userId uint, taskId uint, version uint64) (model.TaskResponse, error) {
+	if err := ta.authorizeEdit(ctx, userId, taskId); err != nil {
+		return model.TaskResponse{}, err
+	}
+	return ta.next.UpdateTask(ctx, task, userId, taskId, version)
+}
+
+func (ta *taskAuthorizer) PatchTask(ctx context.Context, patch []byte, userId uint, taskId uint, version uint64) (model.TaskResponse, error) {
+	if err := ta.authorizeEdit(ctx, userId, taskId); err != nil {
+		return model.TaskResponse{}, err
+	}
+	return ta.next.PatchTask(ctx, patch, userId, taskId, version)
+}
+
+func (ta *taskAuthorizer) DeleteTask(ctx context.Context, userId uint, taskId uint) error {
+	if err := ta.authorizeEdit(ctx, userId, taskId); err != nil {
+		return err
+	}
+	return ta.next.DeleteTask(ctx, userId, taskId)
+}
+
+func (ta *taskAuthorizer) AddDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) (model.TaskDependencyResponse, error) {
+	if err := ta.authorizeEdit(ctx, userId, taskId); err != nil {
+		return model.TaskDependencyResponse{}, err
+	}
+	return ta.next.AddDependency(ctx, userId, taskId, blockerId)
+}
+
+func (ta *taskAuthorizer) RemoveDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) error {
+	if err := ta.authorizeEdit(ctx, userId, taskId); err != nil {
+		return err
+	}
+	return ta.next.RemoveDependency(ctx, userId, taskId, blockerId)
+}
+
+// GetTaskGraph, like GetTaskByID, relies on the repository to leave out the
+// tasks the caller can't see.
+func (ta *taskAuthorizer) GetTaskGraph(ctx context.Context, userId uint, taskId uint) (model.TaskGraph, error) {
+	return ta.next.GetTaskGraph(ctx, userId, taskId)
+}
+
+func (ta *taskAuthorizer) GetTaskOrder(ctx context.Context, userId uint, taskId uint) (model.TaskOrder, error) {
+	return ta.next.GetTaskOrder(ctx, userId, taskId)
+}
+
+// authorizeEdit returns ErrTaskNotFound unless userId may change the task.
+func (ta *taskAuthorizer) authorizeEdit(ctx context.Context, userId uint, taskId uint) error {
+	task := model.Task{}
+	if err := ta.tr.GetTaskByID(ctx, &task, userId, taskId); err != nil {
+		return err
+	}
+	if task.ProjectID == nil {
+		// Only the creator can see a task outside any project.
+		return nil
+	}
+	role, err := ta.mr.GetRole(ctx, uint(*task.ProjectID), userId)
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		return ErrTaskNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !canEditTasks(role) {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// projectRole returns the caller's role in the project, or ErrProjectNotFound
+// when they aren't a member.
+func (ta *taskAuthorizer) projectRole(ctx context.Context, userId uint, projectId uint) (string, error) {
+	role, err := ta.mr.GetRole(ctx, projectId, userId)
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		return "", ErrProjectNotFound
+	}
+	return role, err
+}
+
+func canEditTasks(role string) bool {
+	return role == model.ProjectRoleOwner || role == model.ProjectRoleEditor
+}
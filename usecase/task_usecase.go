@@ -1,96 +1,607 @@
 package usecase
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
 	"go-rest-api/model"
 	"go-rest-api/repository"
 	"go-rest-api/validator"
+	"sort"
+	"time"
 )
 
 type ITaskUseCase interface {
-	GetAllTasks(userID uint) ([]model.TaskResponse, error)
-	GetTaskByID(userId uint, taskid uint) (model.TaskResponse, error)
-	CreateTask(task model.Task) (model.TaskResponse, error)
-	UpdateTask(task model.Task, userId uint, taskId uint) (model.TaskResponse, error)
-	DeleteTask(userId uint, taskId uint) error
+	GetAllTasks(ctx context.Context, userID uint, query model.TaskQuery) (model.TaskListResponse, error)
+	GetTaskByID(ctx context.Context, userId uint, taskid uint) (model.TaskResponse, error)
+	CreateTask(ctx context.Context, task model.Task) (model.TaskResponse, error)
+	UpdateTask(ctx context.Context, task model.Task, userId uint, taskId uint, version uint64) (model.TaskResponse, error)
+	PatchTask(ctx context.Context, patch []byte, userId uint, taskId uint, version uint64) (model.TaskResponse, error)
+	DeleteTask(ctx context.Context, userId uint, taskId uint) error
+	AddDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) (model.TaskDependencyResponse, error)
+	RemoveDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) error
+	GetTaskGraph(ctx context.Context, userId uint, taskId uint) (model.TaskGraph, error)
+	GetTaskOrder(ctx context.Context, userId uint, taskId uint) (model.TaskOrder, error)
 }
 
 type taskUseCase struct {
-	tr repository.ITaskRepository
-	tv validator.ITaskValidator
+	tr  repository.ITaskRepository
+	dr  repository.ITaskDependencyRepository
+	mr  repository.IProjectMemberRepository
+	tv  validator.ITaskValidator
+	cfg config.TaskConfig
 }
 
-func NewTaskUseCase(tr repository.ITaskRepository, tv validator.ITaskValidator) ITaskUseCase {
-	return &taskUseCase{tr, tv}
+const (
+	defaultTaskLimit = 20
+	defaultTaskSort  = "created_at"
+	defaultTaskOrder = "asc"
+)
+
+var (
+	ErrInvalidCursor           = apperror.Validation("invalid cursor", map[string]string{"cursor": "invalid cursor"})
+	ErrInvalidStatusTransition = apperror.Conflict("invalid status transition")
+	ErrVersionMismatch         = apperror.PreconditionFailed("task has been modified")
+	ErrInvalidPatch            = apperror.Validation("invalid merge patch", nil)
+	ErrUnknownProject          = apperror.Validation("project not found", map[string]string{"project_id": "project not found"})
+	ErrUnknownParent           = apperror.Validation("parent task not found", map[string]string{"parent_id": "parent task not found"})
+	ErrSubtaskCycle            = apperror.Validation("a task can't be its own subtask", map[string]string{"parent_id": "must not be the task or one of its subtasks"})
+	ErrSubtaskTooDeep          = apperror.Validation("subtasks are nested too deep", map[string]string{"parent_id": "subtasks are nested too deep"})
+	ErrUnknownBlocker          = apperror.Validation("blocker task not found", map[string]string{"blocker_id": "blocker task not found"})
+	ErrDependencyCycle         = apperror.Validation("dependency would create a cycle", map[string]string{"blocker_id": "must not depend on the task, directly or not"})
+)
+
+// taskFields is the editable part of a task, used as the merge patch target.
+type taskFields struct {
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Status       string     `json:"status"`
+	Priority     string     `json:"priority"`
+	DueDate      *time.Time `json:"due_date"`
+	ProjectID    *uint64    `json:"project_id"`
+	ParentID     *uint64    `json:"parent_id"`
+	AutoComplete bool       `json:"auto_complete"`
+	Tags         []string   `json:"tags"`
+}
+
+// taskStatusTransitions lists the statuses each status may move to.
+// Archived tasks have to be reopened as todo before work can resume.
+var taskStatusTransitions = map[string][]string{
+	model.TaskStatusTodo:       {model.TaskStatusInProgress, model.TaskStatusDone, model.TaskStatusArchived},
+	model.TaskStatusInProgress: {model.TaskStatusTodo, model.TaskStatusDone, model.TaskStatusArchived},
+	model.TaskStatusDone:       {model.TaskStatusTodo, model.TaskStatusInProgress, model.TaskStatusArchived},
+	model.TaskStatusArchived:   {model.TaskStatusTodo},
+}
+
+// NewTaskUseCase returns the task use case without access control; wrap it
+// with NewTaskAuthorizer.
+//
+// A subtask always lives in its parent's project; any project it is sent
+// with is ignored.
+func NewTaskUseCase(tr repository.ITaskRepository, dr repository.ITaskDependencyRepository, mr repository.IProjectMemberRepository, tv validator.ITaskValidator, cfg config.TaskConfig) ITaskUseCase {
+	return &taskUseCase{tr, dr, mr, tv, cfg}
 }
 
-func (tu *taskUseCase) GetAllTasks(userId uint) ([]model.TaskResponse, error) {
+func (tu *taskUseCase) GetAllTasks(ctx context.Context, userId uint, query model.TaskQuery) (model.TaskListResponse, error) {
+	if query.Limit == 0 {
+		query.Limit = defaultTaskLimit
+	}
+	if query.Sort == "" {
+		query.Sort = defaultTaskSort
+	}
+	if query.Order == "" {
+		query.Order = defaultTaskOrder
+	}
+	query.Tags = normalizeTagNames(query.Tags)
+	if len(query.Tags) > 0 && query.TagMatch == "" {
+		query.TagMatch = model.TagMatchAny
+	}
+	if err := tu.tv.TaskQueryValidate(query); err != nil {
+		return model.TaskListResponse{}, err
+	}
+	var after *model.TaskCursor
+	if query.Cursor != "" {
+		cursor, err := decodeTaskCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort || cursor.Order != query.Order {
+			return model.TaskListResponse{}, ErrInvalidCursor
+		}
+		after = &cursor
+	}
+	// Fetch one extra row to find out whether there is a next page.
+	page := query
+	page.Limit = query.Limit + 1
 	tasks := []model.Task{}
-	taskResponses := []model.TaskResponse{}
-	if err := tu.tr.GetAllTasks(&tasks, userId); err != nil {
-		return nil, err
+	var total int64
+	if err := tu.tr.GetAllTasks(ctx, &tasks, &total, userId, page, after); err != nil {
+		return model.TaskListResponse{}, err
+	}
+	res := model.TaskListResponse{Tasks: []model.TaskResponse{}, TotalCount: total}
+	if len(tasks) > query.Limit {
+		tasks = tasks[:query.Limit]
+		res.NextCursor = encodeTaskCursor(query, tasks[len(tasks)-1])
 	}
 	for _, task := range tasks {
-		t := model.TaskResponse{
-			ID:        task.ID,
-			Title:     task.Title,
-			CreatedAt: task.CreatedAt,
-			UpdateAt:  task.UpdateAt,
-		}
-		taskResponses = append(taskResponses, t)
-
+		res.Tasks = append(res.Tasks, newTaskResponse(task))
 	}
-	return taskResponses, nil
+	return res, nil
 }
 
-func (tu *taskUseCase) GetTaskByID(userId uint, taskId uint) (model.TaskResponse, error) {
+func (tu *taskUseCase) GetTaskByID(ctx context.Context, userId uint, taskId uint) (model.TaskResponse, error) {
 	task := model.Task{}
-	if err := tu.tr.GetTaskByID(&task, userId, taskId); err != nil {
+	if err := tu.tr.GetTaskByID(ctx, &task, userId, taskId); err != nil {
 		return model.TaskResponse{}, err
 	}
-	taskResponse := model.TaskResponse{
-		ID:        task.ID,
-		Title:     task.Title,
-		CreatedAt: task.CreatedAt,
-		UpdateAt:  task.UpdateAt,
+	if err := tu.tr.GetSubtasks(ctx, &task.Subtasks, userId, taskId); err != nil {
+		return model.TaskResponse{}, err
 	}
-	return taskResponse, nil
+	return newTaskResponse(task), nil
 }
 
-func (tu *taskUseCase) CreateTask(task model.Task) (model.TaskResponse, error) {
+func (tu *taskUseCase) CreateTask(ctx context.Context, task model.Task) (model.TaskResponse, error) {
+	if task.Status == "" {
+		task.Status = model.TaskStatusTodo
+	}
+	if task.Priority == "" {
+		task.Priority = model.TaskPriorityMedium
+	}
+	task.TagNames = normalizeTagNames(task.TagNames)
 	if err := tu.tv.TaskValidate(task); err != nil {
 		return model.TaskResponse{}, err
 	}
-	if err := tu.tr.CreateTask(&task); err != nil {
+	if err := tu.checkParent(ctx, uint(*task.UserID), &task, 0); err != nil {
+		return model.TaskResponse{}, err
+	}
+	if err := tu.checkProject(ctx, uint(*task.UserID), task.ProjectID); err != nil {
+		return model.TaskResponse{}, err
+	}
+	task.CompletedAt = nil
+	if task.Status == model.TaskStatusDone {
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+	if err := tu.tr.CreateTask(ctx, &task); err != nil {
+		return model.TaskResponse{}, err
+	}
+	if err := tu.completeParents(ctx, task, ""); err != nil {
+		return model.TaskResponse{}, err
+	}
+	return newTaskResponse(task), nil
+}
+
+// UpdateTask replaces the task's editable fields. An empty status, priority,
+// project or parent and missing tags keep the stored value, so clients that
+// only send a title don't reset them; a task is taken out of its project or
+// parent with PatchTask.
+// A version of 0 skips the version check (If-Match: *).
+func (tu *taskUseCase) UpdateTask(ctx context.Context, task model.Task, userId uint, taskId uint, version uint64) (model.TaskResponse, error) {
+	current := model.Task{}
+	if err := tu.tr.GetTaskByID(ctx, &current, userId, taskId); err != nil {
+		return model.TaskResponse{}, err
+	}
+	if task.Status == "" {
+		task.Status = current.Status
+	}
+	if task.Priority == "" {
+		task.Priority = current.Priority
+	}
+	if task.ProjectID == nil {
+		task.ProjectID = current.ProjectID
+	}
+	if task.ParentID == nil {
+		task.ParentID = current.ParentID
+	}
+	return tu.saveTask(ctx, current, task, userId, taskId, version)
+}
+
+// PatchTask applies an RFC 7386 JSON Merge Patch to the task's editable fields.
+func (tu *taskUseCase) PatchTask(ctx context.Context, patch []byte, userId uint, taskId uint, version uint64) (model.TaskResponse, error) {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return model.TaskResponse{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	current := model.Task{}
+	if err := tu.tr.GetTaskByID(ctx, &current, userId, taskId); err != nil {
+		return model.TaskResponse{}, err
+	}
+	doc, err := json.Marshal(taskFields{
+		Title:        current.Title,
+		Description:  current.Description,
+		Status:       current.Status,
+		Priority:     current.Priority,
+		DueDate:      current.DueDate,
+		ProjectID:    current.ProjectID,
+		ParentID:     current.ParentID,
+		AutoComplete: current.AutoComplete,
+		Tags:         tagNames(current.Tags),
+	})
+	if err != nil {
+		return model.TaskResponse{}, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return model.TaskResponse{}, err
+	}
+	merged, err := json.Marshal(mergePatch(target, patchDoc))
+	if err != nil {
 		return model.TaskResponse{}, err
 	}
-	taskResponse := model.TaskResponse{
-		ID:        task.ID,
-		Title:     task.Title,
-		CreatedAt: task.CreatedAt,
-		UpdateAt:  task.UpdateAt,
+	fields := taskFields{}
+	if err := json.Unmarshal(merged, &fields); err != nil {
+		return model.TaskResponse{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	task := model.Task{
+		Title:        fields.Title,
+		Description:  fields.Description,
+		Status:       fields.Status,
+		Priority:     fields.Priority,
+		DueDate:      fields.DueDate,
+		ProjectID:    fields.ProjectID,
+		ParentID:     fields.ParentID,
+		AutoComplete: fields.AutoComplete,
+		UserID:       current.UserID,
+	}
+	// Tags are only rewritten when the patch names them; null removes them all.
+	if patchObj, ok := patchDoc.(map[string]interface{}); ok {
+		if _, ok := patchObj["tags"]; ok {
+			task.TagNames = fields.Tags
+			if task.TagNames == nil {
+				task.TagNames = []string{}
+			}
+		}
 	}
-	return taskResponse, nil
+	return tu.saveTask(ctx, current, task, userId, taskId, version)
 }
 
-func (tu *taskUseCase) UpdateTask(task model.Task, userId uint, taskId uint) (model.TaskResponse, error) {
+func (tu *taskUseCase) saveTask(ctx context.Context, current model.Task, task model.Task, userId uint, taskId uint, version uint64) (model.TaskResponse, error) {
+	if version == 0 {
+		version = current.Version
+	}
+	if current.Version != version {
+		return model.TaskResponse{}, ErrVersionMismatch
+	}
+	task.TagNames = normalizeTagNames(task.TagNames)
 	if err := tu.tv.TaskValidate(task); err != nil {
 		return model.TaskResponse{}, err
 	}
-	if err := tu.tr.UpdateTask(&task, userId, taskId); err != nil {
+	if err := checkStatusTransition(current.Status, task.Status); err != nil {
+		return model.TaskResponse{}, err
+	}
+	if task.Status == model.TaskStatusDone && current.Status != model.TaskStatusDone {
+		if err := tu.checkBlockers(ctx, userId, taskId); err != nil {
+			return model.TaskResponse{}, err
+		}
+	}
+	if task.ParentID != nil && current.ParentID != nil && *task.ParentID == *current.ParentID {
+		task.ProjectID = current.ProjectID
+	} else if err := tu.checkParent(ctx, userId, &task, taskId); err != nil {
 		return model.TaskResponse{}, err
 	}
-	taskResponse := model.TaskResponse{
-		ID:        task.ID,
-		Title:     task.Title,
-		CreatedAt: task.CreatedAt,
-		UpdateAt:  task.UpdateAt,
+	if task.ProjectID != nil && (current.ProjectID == nil || *task.ProjectID != *current.ProjectID) {
+		if err := tu.checkProject(ctx, userId, task.ProjectID); err != nil {
+			return model.TaskResponse{}, err
+		}
 	}
-	return taskResponse, nil
+	task.CompletedAt = current.CompletedAt
+	switch {
+	case task.Status == model.TaskStatusDone && current.Status != model.TaskStatusDone:
+		now := time.Now()
+		task.CompletedAt = &now
+	case task.Status == model.TaskStatusTodo || task.Status == model.TaskStatusInProgress:
+		task.CompletedAt = nil
+	}
+	if err := tu.tr.UpdateTask(ctx, &task, userId, taskId, version); err != nil {
+		if errors.Is(err, repository.ErrTaskVersionConflict) {
+			return model.TaskResponse{}, ErrVersionMismatch
+		}
+		return model.TaskResponse{}, err
+	}
+	if task.TagNames == nil {
+		task.Tags = current.Tags
+	}
+	task.SubtaskCount, task.DoneSubtaskCount = current.SubtaskCount, current.DoneSubtaskCount
+	if err := tu.completeParents(ctx, task, current.Status); err != nil {
+		return model.TaskResponse{}, err
+	}
+	return newTaskResponse(task), nil
 }
 
-func (tu *taskUseCase) DeleteTask(userId uint, taskId uint) error {
-	if err := tu.tr.DeleteTask(userId, taskId); err != nil {
+func (tu *taskUseCase) DeleteTask(ctx context.Context, userId uint, taskId uint) error {
+	if err := tu.tr.DeleteTask(ctx, userId, taskId); err != nil {
 		return err
 	}
 	return nil
 }
+
+// AddDependency records that the task is blocked by blockerId, which has to
+// be a task the user can see and must not itself depend on the task.
+func (tu *taskUseCase) AddDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) (model.TaskDependencyResponse, error) {
+	if taskId == blockerId {
+		return model.TaskDependencyResponse{}, ErrDependencyCycle
+	}
+	blocker := model.Task{}
+	if err := tu.tr.GetTaskByID(ctx, &blocker, userId, blockerId); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return model.TaskDependencyResponse{}, ErrUnknownBlocker
+		}
+		return model.TaskDependencyResponse{}, err
+	}
+	dependency := model.TaskDependency{TaskID: uint64(taskId), BlockerID: uint64(blockerId)}
+	if err := tu.dr.AddDependency(ctx, &dependency); err != nil {
+		if errors.Is(err, repository.ErrDependencyCycle) {
+			return model.TaskDependencyResponse{}, ErrDependencyCycle
+		}
+		return model.TaskDependencyResponse{}, err
+	}
+	return newTaskDependencyResponse(dependency), nil
+}
+
+func (tu *taskUseCase) RemoveDependency(ctx context.Context, userId uint, taskId uint, blockerId uint) error {
+	if err := tu.dr.RemoveDependency(ctx, taskId, blockerId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetTaskGraph returns the dependency graph around the task, leaving out the
+// tasks the user can't see.
+func (tu *taskUseCase) GetTaskGraph(ctx context.Context, userId uint, taskId uint) (model.TaskGraph, error) {
+	task := model.Task{}
+	if err := tu.tr.GetTaskByID(ctx, &task, userId, taskId); err != nil {
+		return model.TaskGraph{}, err
+	}
+	tasks := []model.Task{}
+	dependencies := []model.TaskDependency{}
+	if err := tu.dr.GetGraph(ctx, &tasks, &dependencies, userId, taskId); err != nil {
+		return model.TaskGraph{}, err
+	}
+	graph := model.TaskGraph{Nodes: []model.TaskGraphNode{}, Edges: []model.TaskDependencyResponse{}}
+	for _, task := range tasks {
+		graph.Nodes = append(graph.Nodes, model.TaskGraphNode{ID: task.ID, Title: task.Title, Status: task.Status})
+	}
+	for _, dependency := range dependencies {
+		graph.Edges = append(graph.Edges, newTaskDependencyResponse(dependency))
+	}
+	return graph, nil
+}
+
+// GetTaskOrder returns the tasks of the task's dependency graph in an order
+// they can be worked through.
+func (tu *taskUseCase) GetTaskOrder(ctx context.Context, userId uint, taskId uint) (model.TaskOrder, error) {
+	graph, err := tu.GetTaskGraph(ctx, userId, taskId)
+	if err != nil {
+		return model.TaskOrder{}, err
+	}
+	order, err := orderTaskGraph(graph)
+	if err != nil {
+		return model.TaskOrder{}, err
+	}
+	return model.TaskOrder{Tasks: order}, nil
+}
+
+// checkBlockers refuses to let the task be marked done while any of its
+// blockers is still open. Blockers the user can't read are only counted.
+func (tu *taskUseCase) checkBlockers(ctx context.Context, userId uint, taskId uint) error {
+	ids, hidden, err := tu.dr.GetOpenBlockerIDs(ctx, userId, taskId)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 || hidden > 0 {
+		return apperror.ConflictWith(
+			fmt.Sprintf("task is blocked by %d open tasks", int64(len(ids))+hidden),
+			map[string]interface{}{"blocker_ids": ids},
+		)
+	}
+	return nil
+}
+
+// checkProject makes sure projectId, when set, is a project the user may add tasks to.
+func (tu *taskUseCase) checkProject(ctx context.Context, userId uint, projectId *uint64) error {
+	if projectId == nil {
+		return nil
+	}
+	role, err := tu.mr.GetRole(ctx, uint(*projectId), userId)
+	if apperror.KindOf(err) == apperror.KindNotFound || (err == nil && !canEditTasks(role)) {
+		return ErrUnknownProject
+	}
+	return err
+}
+
+// checkParent makes sure the task's parent, when set, is a task the user can
+// add subtasks to, that it isn't the task itself or one of its subtasks, and that the
+// task's subtasks won't end up nested deeper than allowed. The task is moved
+// to its parent's project. taskId is 0 for a new task.
+func (tu *taskUseCase) checkParent(ctx context.Context, userId uint, task *model.Task, taskId uint) error {
+	if task.ParentID == nil {
+		return nil
+	}
+	if *task.ParentID == uint64(taskId) {
+		return ErrSubtaskCycle
+	}
+	parent := model.Task{}
+	if err := tu.tr.GetTaskByID(ctx, &parent, userId, uint(*task.ParentID)); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return ErrUnknownParent
+		}
+		return err
+	}
+	// Adding subtasks takes the same access as adding tasks to the project.
+	if err := tu.checkProject(ctx, userId, parent.ProjectID); err != nil {
+		if errors.Is(err, ErrUnknownProject) {
+			return ErrUnknownParent
+		}
+		return err
+	}
+	ancestors, err := tu.tr.GetAncestorIDs(ctx, uint(parent.ID))
+	if err != nil {
+		return err
+	}
+	height := 0
+	if taskId != 0 {
+		for _, id := range ancestors {
+			if id == uint64(taskId) {
+				return ErrSubtaskCycle
+			}
+		}
+		if height, err = tu.tr.GetSubtreeHeight(ctx, taskId); err != nil {
+			return err
+		}
+	}
+	// The task sits one level below the last of its ancestors.
+	if len(ancestors)+height > tu.cfg.MaxSubtaskDepth {
+		return ErrSubtaskTooDeep
+	}
+	task.ProjectID = parent.ProjectID
+	return nil
+}
+
+// completeParents auto-completes the task's parents once the task has just
+// been marked done; from is its status before.
+func (tu *taskUseCase) completeParents(ctx context.Context, task model.Task, from string) error {
+	if task.ParentID == nil || task.Status != model.TaskStatusDone || from == model.TaskStatusDone {
+		return nil
+	}
+	return tu.tr.CompleteParents(ctx, uint(*task.ParentID))
+}
+
+func encodeTaskCursor(query model.TaskQuery, last model.Task) string {
+	cursor := model.TaskCursor{Sort: query.Sort, Order: query.Order, ID: last.ID}
+	switch query.Sort {
+	case "created_at":
+		cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = last.UpdateAt.Format(time.RFC3339Nano)
+	case "title":
+		cursor.Value = last.Title
+	}
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTaskCursor(s string) (model.TaskCursor, error) {
+	cursor := model.TaskCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return cursor, err
+	}
+	return cursor, nil
+}
+
+func checkStatusTransition(from string, to string) error {
+	if from == to {
+		return nil
+	}
+	for _, next := range taskStatusTransitions[from] {
+		if next == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, from, to)
+}
+
+func newTaskResponse(task model.Task) model.TaskResponse {
+	res := model.TaskResponse{
+		ID:           task.ID,
+		Title:        task.Title,
+		Description:  task.Description,
+		Status:       task.Status,
+		Priority:     task.Priority,
+		DueDate:      task.DueDate,
+		CompletedAt:  task.CompletedAt,
+		ProjectID:    task.ProjectID,
+		ParentID:     task.ParentID,
+		AutoComplete: task.AutoComplete,
+		Tags:         tagNames(task.Tags),
+		Progress:     model.TaskProgress{Done: task.DoneSubtaskCount, Total: task.SubtaskCount},
+		Version:      task.Version,
+		CreatedAt:    task.CreatedAt,
+		UpdateAt:     task.UpdateAt,
+	}
+	for _, subtask := range task.Subtasks {
+		res.Subtasks = append(res.Subtasks, newTaskResponse(subtask))
+	}
+	return res
+}
+
+func newTaskDependencyResponse(dependency model.TaskDependency) model.TaskDependencyResponse {
+	return model.TaskDependencyResponse{
+		TaskID:    dependency.TaskID,
+		BlockerID: dependency.BlockerID,
+		CreatedAt: dependency.CreatedAt,
+	}
+}
+
+// orderTaskGraph sorts the graph's tasks topologically, so that every task
+// comes after its blockers, taking the lowest ID first whenever several tasks
+// are free to go next.
+func orderTaskGraph(graph model.TaskGraph) ([]model.TaskGraphNode, error) {
+	nodes := map[uint64]model.TaskGraphNode{}
+	blockers := map[uint64]int{}
+	dependents := map[uint64][]uint64{}
+	for _, edge := range graph.Edges {
+		blockers[edge.TaskID]++
+		dependents[edge.BlockerID] = append(dependents[edge.BlockerID], edge.TaskID)
+	}
+	ready := []uint64{}
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+		if blockers[node.ID] == 0 {
+			ready = append(ready, node.ID)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+	order := make([]model.TaskGraphNode, 0, len(graph.Nodes))
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, nodes[id])
+		for _, next := range dependents[id] {
+			blockers[next]--
+			if blockers[next] > 0 {
+				continue
+			}
+			i := sort.Search(len(ready), func(i int) bool { return ready[i] > next })
+			ready = append(ready, 0)
+			copy(ready[i+1:], ready[i:])
+			ready[i] = next
+		}
+	}
+	if len(order) != len(graph.Nodes) {
+		return nil, errors.New("task dependencies contain a cycle")
+	}
+	return order, nil
+}
+
+func tagNames(tags []model.Tag) []string {
+	names := []string{}
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386 section 2.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = mergePatch(targetObj[name], value)
+	}
+	return targetObj
+}
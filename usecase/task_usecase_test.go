@@ -0,0 +1,488 @@
+package usecase_test
+
+import (
+	"context"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
+	"go-rest-api/model"
+	"go-rest-api/repository"
+	"go-rest-api/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockTaskRepository struct {
+	mock.Mock
+}
+
+type mockTaskValidator struct {
+	mock.Mock
+}
+
+func (m *mockTaskRepository) GetAllTasks(ctx context.Context, tasks *[]model.Task, total *int64, userID uint, query model.TaskQuery, after *model.TaskCursor) error {
+	args := m.Called(tasks, total, userID, query, after)
+	if args.Get(0) != nil {
+		*tasks = args.Get(0).([]model.Task)
+	}
+	*total = int64(len(*tasks))
+	return args.Error(1)
+}
+
+func (m *mockTaskRepository) GetTaskByID(ctx context.Context, task *model.Task, userId uint, taskid uint) error {
+	args := m.Called(task, userId, taskid)
+	return args.Error(0)
+}
+
+func (m *mockTaskRepository) GetSubtasks(ctx context.Context, tasks *[]model.Task, userId uint, taskId uint) error {
+	args := m.Called(tasks, userId, taskId)
+	if args.Get(0) != nil {
+		*tasks = args.Get(0).([]model.Task)
+	}
+	return args.Error(1)
+}
+
+func (m *mockTaskRepository) GetAncestorIDs(ctx context.Context, taskId uint) ([]uint64, error) {
+	args := m.Called(taskId)
+	return args.Get(0).([]uint64), args.Error(1)
+}
+
+func (m *mockTaskRepository) GetSubtreeHeight(ctx context.Context, taskId uint) (int, error) {
+	args := m.Called(taskId)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *mockTaskRepository) CompleteParents(ctx context.Context, taskId uint) error {
+	args := m.Called(taskId)
+	return args.Error(0)
+}
+
+func (m *mockTaskRepository) CreateTask(ctx context.Context, task *model.Task) error {
+	args := m.Called(task)
+	return args.Error(0)
+}
+
+func (m *mockTaskRepository) UpdateTask(ctx context.Context, task *model.Task, userId uint, taskId uint, version uint64) error {
+	args := m.Called(task, userId, taskId, version)
+	return args.Error(0)
+}
+
+func (m *mockTaskRepository) DeleteTask(ctx context.Context, userId uint, taskId uint) error {
+	args := m.Called(userId, taskId)
+	return args.Error(0)
+}
+
+type mockTaskDependencyRepository struct {
+	mock.Mock
+}
+
+var taskConfig = config.TaskConfig{MaxSubtaskDepth: 2}
+
+func (m *mockTaskDependencyRepository) AddDependency(ctx context.Context, dependency *model.TaskDependency) error {
+	args := m.Called(dependency)
+	return args.Error(0)
+}
+
+func (m *mockTaskDependencyRepository) RemoveDependency(ctx context.Context, taskId uint, blockerId uint) error {
+	args := m.Called(taskId, blockerId)
+	return args.Error(0)
+}
+
+func (m *mockTaskDependencyRepository) GetOpenBlockerIDs(ctx context.Context, userId uint, taskId uint) ([]uint64, int64, error) {
+	args := m.Called(userId, taskId)
+	return args.Get(0).([]uint64), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *mockTaskDependencyRepository) GetGraph(ctx context.Context, tasks *[]model.Task, dependencies *[]model.TaskDependency, userId uint, taskId uint) error {
+	args := m.Called(tasks, dependencies, userId, taskId)
+	if args.Get(0) != nil {
+		*tasks = args.Get(0).([]model.Task)
+	}
+	if args.Get(1) != nil {
+		*dependencies = args.Get(1).([]model.TaskDependency)
+	}
+	return args.Error(2)
+}
+
+func (m *mockTaskValidator) TaskValidate(task model.Task) error {
+	args := m.Called(task)
+	return args.Error(0)
+}
+
+func (m *mockTaskValidator) TaskQueryValidate(query model.TaskQuery) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func TestGetAllTasksPaginates(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	query := model.TaskQuery{Limit: 2}
+	defaulted := model.TaskQuery{Limit: 2, Sort: "created_at", Order: "asc"}
+	fetched := model.TaskQuery{Limit: 3, Sort: "created_at", Order: "asc"}
+	tasks := []model.Task{{ID: 1, Title: "a"}, {ID: 2, Title: "b"}, {ID: 3, Title: "c"}}
+
+	mockTaskValid.On("TaskQueryValidate", defaulted).Return(nil)
+	mockTaskRepo.On("GetAllTasks", mock.Anything, mock.Anything, uint(1), fetched, (*model.TaskCursor)(nil)).Return(tasks, nil)
+	res, err := uc.GetAllTasks(context.Background(), 1, query)
+	assert.NoError(t, err)
+	assert.Len(t, res.Tasks, 2)
+	assert.Equal(t, uint64(2), res.Tasks[1].ID)
+	assert.NotEmpty(t, res.NextCursor)
+
+	next := defaulted
+	next.Cursor = res.NextCursor
+	fetchedNext := fetched
+	fetchedNext.Cursor = res.NextCursor
+	mockTaskValid.On("TaskQueryValidate", next).Return(nil)
+	mockTaskRepo.On("GetAllTasks", mock.Anything, mock.Anything, uint(1), fetchedNext, mock.MatchedBy(func(c *model.TaskCursor) bool {
+		return c != nil && c.ID == 2 && c.Sort == "created_at"
+	})).Return(tasks[2:], nil)
+	res, err = uc.GetAllTasks(context.Background(), 1, model.TaskQuery{Limit: 2, Cursor: res.NextCursor})
+	assert.NoError(t, err)
+	assert.Len(t, res.Tasks, 1)
+	assert.Empty(t, res.NextCursor)
+}
+
+func TestGetAllTasksInvalidCursor(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+
+	mockTaskValid.On("TaskQueryValidate", mock.Anything).Return(nil)
+	_, err := uc.GetAllTasks(context.Background(), 1, model.TaskQuery{Cursor: "not-a-cursor"})
+	assert.Equal(t, usecase.ErrInvalidCursor, err)
+	mockTaskRepo.AssertNotCalled(t, "GetAllTasks", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateTaskCompletesTask(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	mockDependencyRepo := new(mockTaskDependencyRepository)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, mockDependencyRepo, new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusInProgress, Priority: model.TaskPriorityHigh}
+	task := model.Task{Title: "task", Status: model.TaskStatusDone}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockDependencyRepo.On("GetOpenBlockerIDs", uint(1), uint(1)).Return([]uint64{}, int64(0), nil)
+	mockTaskRepo.On("UpdateTask", mock.AnythingOfType("*model.Task"), uint(1), uint(1), uint64(0)).Return(nil)
+	res, err := uc.UpdateTask(context.Background(), task, 1, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TaskStatusDone, res.Status)
+	assert.Equal(t, model.TaskPriorityHigh, res.Priority)
+	assert.NotNil(t, res.CompletedAt)
+}
+
+func TestUpdateTaskRejectsArchivedToInProgress(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusArchived, Priority: model.TaskPriorityMedium}
+	task := model.Task{Title: "task", Status: model.TaskStatusInProgress}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	_, err := uc.UpdateTask(context.Background(), task, 1, 1, 0)
+	assert.ErrorIs(t, err, usecase.ErrInvalidStatusTransition)
+	mockTaskRepo.AssertNotCalled(t, "UpdateTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatchTaskMergesFields(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	due := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := model.Task{ID: 1, Title: "task", Description: "keep me", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow, DueDate: &due, Version: 3}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("UpdateTask", mock.MatchedBy(func(task *model.Task) bool {
+		return task.Title == "renamed" && task.Description == "keep me" && task.Priority == model.TaskPriorityLow && task.DueDate == nil
+	}), uint(1), uint(1), uint64(3)).Return(nil)
+	_, err := uc.PatchTask(context.Background(), []byte(`{"title":"renamed","due_date":null}`), 1, 1, 3)
+	assert.NoError(t, err)
+	mockTaskRepo.AssertExpectations(t)
+}
+
+func TestPatchTaskStaleVersion(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow, Version: 4}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	_, err := uc.PatchTask(context.Background(), []byte(`{"title":"renamed"}`), 1, 1, 3)
+	assert.Equal(t, usecase.ErrVersionMismatch, err)
+	mockTaskRepo.AssertNotCalled(t, "UpdateTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateTaskConcurrentWriteLoses(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow, Version: 3}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("UpdateTask", mock.AnythingOfType("*model.Task"), uint(1), uint(1), uint64(3)).Return(repository.ErrTaskVersionConflict)
+	_, err := uc.UpdateTask(context.Background(), model.Task{Title: "renamed"}, 1, 1, 3)
+	assert.Equal(t, usecase.ErrVersionMismatch, err)
+}
+
+func TestCreateTaskRejectsUnknownProject(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockMemberRepo := new(mockProjectMemberRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), mockMemberRepo, mockTaskValid, taskConfig)
+	userId, unknown, viewed := uint64(1), uint64(7), uint64(8)
+
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockMemberRepo.On("GetRole", uint(7), uint(1)).Return("", apperror.NotFound("project not found"))
+	mockMemberRepo.On("GetRole", uint(8), uint(1)).Return(model.ProjectRoleViewer, nil)
+	_, err := uc.CreateTask(context.Background(), model.Task{Title: "task", UserID: &userId, ProjectID: &unknown})
+	assert.Equal(t, usecase.ErrUnknownProject, err)
+	_, err = uc.CreateTask(context.Background(), model.Task{Title: "task", UserID: &userId, ProjectID: &viewed})
+	assert.Equal(t, usecase.ErrUnknownProject, err)
+	mockTaskRepo.AssertNotCalled(t, "CreateTask", mock.Anything)
+}
+
+func newAuthorizedTaskUseCase(tr *mockTaskRepository, mr *mockProjectMemberRepository) usecase.ITaskUseCase {
+	return usecase.NewTaskAuthorizer(usecase.NewTaskUseCase(tr, new(mockTaskDependencyRepository), mr, new(mockTaskValidator), taskConfig), tr, mr)
+}
+
+func TestTaskAuthorizerHidesTasksFromViewers(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockMemberRepo := new(mockProjectMemberRepository)
+	uc := newAuthorizedTaskUseCase(mockTaskRepo, mockMemberRepo)
+	projectId := uint64(2)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow, ProjectID: &projectId}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(3), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskRepo.On("GetSubtasks", mock.Anything, uint(3), uint(1)).Return(nil, nil)
+	mockMemberRepo.On("GetRole", uint(2), uint(3)).Return(model.ProjectRoleViewer, nil)
+	res, err := uc.GetTaskByID(context.Background(), 3, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "task", res.Title)
+
+	_, err = uc.UpdateTask(context.Background(), model.Task{Title: "renamed"}, 3, 1, 0)
+	assert.Equal(t, usecase.ErrTaskNotFound, err)
+	assert.Equal(t, usecase.ErrTaskNotFound, uc.DeleteTask(context.Background(), 3, 1))
+	mockTaskRepo.AssertNotCalled(t, "UpdateTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockTaskRepo.AssertNotCalled(t, "DeleteTask", mock.Anything, mock.Anything)
+}
+
+func TestTaskAuthorizerHidesProjectsFromNonMembers(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockMemberRepo := new(mockProjectMemberRepository)
+	uc := newAuthorizedTaskUseCase(mockTaskRepo, mockMemberRepo)
+
+	mockMemberRepo.On("GetRole", uint(2), uint(3)).Return("", apperror.NotFound("project not found"))
+	_, err := uc.GetAllTasks(context.Background(), 3, model.TaskQuery{ProjectID: 2})
+	assert.Equal(t, usecase.ErrProjectNotFound, err)
+	mockTaskRepo.AssertNotCalled(t, "GetAllTasks", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetAllTasksFiltersByAnyTagByDefault(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	defaulted := model.TaskQuery{Limit: 20, Sort: "created_at", Order: "asc", Tags: []string{"bug", "urgent"}, TagMatch: model.TagMatchAny}
+
+	mockTaskValid.On("TaskQueryValidate", defaulted).Return(nil)
+	mockTaskRepo.On("GetAllTasks", mock.Anything, mock.Anything, uint(1), mock.MatchedBy(func(q model.TaskQuery) bool {
+		return q.TagMatch == model.TagMatchAny && len(q.Tags) == 2
+	}), (*model.TaskCursor)(nil)).Return([]model.Task{{ID: 1, Title: "a", Tags: []model.Tag{{Name: "bug"}}}}, nil)
+	res, err := uc.GetAllTasks(context.Background(), 1, model.TaskQuery{Tags: []string{" bug", "urgent", "BUG"}})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Tasks, 1) {
+		assert.Equal(t, []string{"bug"}, res.Tasks[0].Tags)
+	}
+}
+
+func TestUpdateTaskKeepsTagsUnlessSent(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	current := model.Task{ID: 1, Title: "task", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow, Tags: []model.Tag{{ID: 3, Name: "bug"}}}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("UpdateTask", mock.MatchedBy(func(task *model.Task) bool {
+		return task.TagNames == nil
+	}), uint(1), uint(1), uint64(0)).Return(nil).Once()
+	res, err := uc.UpdateTask(context.Background(), model.Task{Title: "renamed"}, 1, 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bug"}, res.Tags)
+
+	mockTaskRepo.On("UpdateTask", mock.MatchedBy(func(task *model.Task) bool {
+		return task.TagNames != nil && len(task.TagNames) == 0
+	}), uint(1), uint(1), uint64(0)).Return(nil).Once()
+	_, err = uc.PatchTask(context.Background(), []byte(`{"tags":null}`), 1, 1, 0)
+	assert.NoError(t, err)
+	mockTaskRepo.AssertExpectations(t)
+}
+
+func TestCreateSubtaskJoinsParentProject(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockMemberRepo := new(mockProjectMemberRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), mockMemberRepo, mockTaskValid, taskConfig)
+	userId, projectId, parentId := uint64(1), uint64(7), uint64(2)
+	parent := model.Task{ID: 2, Title: "parent", ProjectID: &projectId}
+
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(2)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = parent
+	})
+	mockMemberRepo.On("GetRole", uint(7), uint(1)).Return(model.ProjectRoleEditor, nil)
+	mockTaskRepo.On("GetAncestorIDs", uint(2)).Return([]uint64{2}, nil)
+	mockTaskRepo.On("CreateTask", mock.MatchedBy(func(task *model.Task) bool {
+		return task.ProjectID != nil && *task.ProjectID == projectId
+	})).Return(nil)
+	res, err := uc.CreateTask(context.Background(), model.Task{Title: "step", UserID: &userId, ParentID: &parentId})
+	assert.NoError(t, err)
+	assert.Equal(t, &parentId, res.ParentID)
+	assert.Equal(t, &projectId, res.ProjectID)
+}
+
+func TestCreateSubtaskRejectsTooDeep(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	userId, parentId := uint64(1), uint64(3)
+
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(3)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = model.Task{ID: 3, Title: "grandchild"}
+	})
+	mockTaskRepo.On("GetAncestorIDs", uint(3)).Return([]uint64{3, 2, 1}, nil)
+	_, err := uc.CreateTask(context.Background(), model.Task{Title: "step", UserID: &userId, ParentID: &parentId})
+	assert.Equal(t, usecase.ErrSubtaskTooDeep, err)
+	mockTaskRepo.AssertNotCalled(t, "CreateTask", mock.Anything)
+}
+
+func TestUpdateTaskRejectsMovingUnderOwnSubtask(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	parentId := uint64(4)
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = model.Task{ID: 1, Title: "task", Status: model.TaskStatusTodo, Priority: model.TaskPriorityLow}
+	})
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(4)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = model.Task{ID: 4, Title: "subtask"}
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockTaskRepo.On("GetAncestorIDs", uint(4)).Return([]uint64{4, 1}, nil)
+	_, err := uc.UpdateTask(context.Background(), model.Task{Title: "task", ParentID: &parentId}, 1, 1, 0)
+	assert.Equal(t, usecase.ErrSubtaskCycle, err)
+	mockTaskRepo.AssertNotCalled(t, "UpdateTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCompletingSubtaskCompletesParents(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockTaskValid := new(mockTaskValidator)
+	mockDependencyRepo := new(mockTaskDependencyRepository)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, mockDependencyRepo, new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+	parentId := uint64(2)
+	current := model.Task{ID: 1, Title: "step", Status: model.TaskStatusInProgress, Priority: model.TaskPriorityLow, ParentID: &parentId}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = current
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockDependencyRepo.On("GetOpenBlockerIDs", uint(1), uint(1)).Return([]uint64{}, int64(0), nil)
+	mockTaskRepo.On("UpdateTask", mock.AnythingOfType("*model.Task"), uint(1), uint(1), uint64(0)).Return(nil)
+	mockTaskRepo.On("CompleteParents", uint(2)).Return(nil).Once()
+	_, err := uc.PatchTask(context.Background(), []byte(`{"status":"done"}`), 1, 1, 0)
+	assert.NoError(t, err)
+	mockTaskRepo.AssertExpectations(t)
+}
+
+func TestGetTaskByIDEmbedsSubtasks(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, new(mockTaskDependencyRepository), new(mockProjectMemberRepository), new(mockTaskValidator), taskConfig)
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = model.Task{ID: 1, Title: "task", SubtaskCount: 2, DoneSubtaskCount: 1}
+	})
+	mockTaskRepo.On("GetSubtasks", mock.Anything, uint(1), uint(1)).Return([]model.Task{{ID: 2, Title: "a"}, {ID: 3, Title: "b"}}, nil)
+	res, err := uc.GetTaskByID(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TaskProgress{Done: 1, Total: 2}, res.Progress)
+	assert.Len(t, res.Subtasks, 2)
+}
+
+func TestUpdateTaskRefusesDoneWhileBlocked(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockDependencyRepo := new(mockTaskDependencyRepository)
+	mockTaskValid := new(mockTaskValidator)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, mockDependencyRepo, new(mockProjectMemberRepository), mockTaskValid, taskConfig)
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*model.Task) = model.Task{ID: 1, Title: "task", Status: model.TaskStatusInProgress, Priority: model.TaskPriorityLow}
+	})
+	mockTaskValid.On("TaskValidate", mock.AnythingOfType("model.Task")).Return(nil)
+	mockDependencyRepo.On("GetOpenBlockerIDs", uint(1), uint(1)).Return([]uint64{4, 5}, int64(2), nil)
+	_, err := uc.UpdateTask(context.Background(), model.Task{Title: "task", Status: model.TaskStatusDone}, 1, 1, 0)
+	var appErr *apperror.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, apperror.KindConflict, appErr.Kind)
+		assert.Equal(t, "task is blocked by 4 open tasks", appErr.Detail)
+		// Blockers in projects the user can't see are counted, not named.
+		assert.Equal(t, []uint64{4, 5}, appErr.Extensions["blocker_ids"])
+	}
+	mockTaskRepo.AssertNotCalled(t, "UpdateTask", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddDependencyRejectsCycle(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockDependencyRepo := new(mockTaskDependencyRepository)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, mockDependencyRepo, new(mockProjectMemberRepository), new(mockTaskValidator), taskConfig)
+
+	_, err := uc.AddDependency(context.Background(), 1, 2, 2)
+	assert.Equal(t, usecase.ErrDependencyCycle, err)
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(3)).Return(nil)
+	mockDependencyRepo.On("AddDependency", &model.TaskDependency{TaskID: 2, BlockerID: 3}).Return(repository.ErrDependencyCycle)
+	_, err = uc.AddDependency(context.Background(), 1, 2, 3)
+	assert.Equal(t, usecase.ErrDependencyCycle, err)
+}
+
+func TestGetTaskOrderPutsBlockersFirst(t *testing.T) {
+	mockTaskRepo := new(mockTaskRepository)
+	mockDependencyRepo := new(mockTaskDependencyRepository)
+	uc := usecase.NewTaskUseCase(mockTaskRepo, mockDependencyRepo, new(mockProjectMemberRepository), new(mockTaskValidator), taskConfig)
+	tasks := []model.Task{{ID: 1, Title: "ship"}, {ID: 2, Title: "test"}, {ID: 3, Title: "build"}, {ID: 4, Title: "docs"}}
+	// ship is blocked by test and docs; test is blocked by build.
+	dependencies := []model.TaskDependency{{TaskID: 1, BlockerID: 2}, {TaskID: 1, BlockerID: 4}, {TaskID: 2, BlockerID: 3}}
+
+	mockTaskRepo.On("GetTaskByID", mock.AnythingOfType("*model.Task"), uint(1), uint(1)).Return(nil)
+	mockDependencyRepo.On("GetGraph", mock.Anything, mock.Anything, uint(1), uint(1)).Return(tasks, dependencies, nil)
+	res, err := uc.GetTaskOrder(context.Background(), 1, 1)
+	assert.NoError(t, err)
+	ids := []uint64{}
+	for _, task := range res.Tasks {
+		ids = append(ids, task.ID)
+	}
+	assert.Equal(t, []uint64{3, 2, 4, 1}, ids)
+}
@@ -1,79 +1,916 @@
 package usecase
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
+	"go-rest-api/mailer"
 	"go-rest-api/model"
 	"go-rest-api/repository"
+	"go-rest-api/totp"
 	"go-rest-api/validator"
-	"os"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidCredentials  = apperror.Unauthorized("invalid email or password")
+	ErrInvalidRefreshToken = apperror.Unauthorized("invalid refresh token")
+	ErrRefreshTokenReused  = apperror.Unauthorized("refresh token reused")
+	ErrEmailNotVerified    = apperror.Forbidden("email address is not verified")
+	ErrInvalidVerification = apperror.Validation("invalid or expired verification token", map[string]string{"token": "invalid or expired"})
+	ErrInvalidResetToken   = apperror.Validation("invalid or expired reset token", map[string]string{"token": "invalid or expired"})
+	ErrIncorrectPassword   = apperror.Validation("password is incorrect", map[string]string{"password": "incorrect password"})
+	ErrInvalidMFAToken     = apperror.Unauthorized("invalid or expired mfa token")
+	ErrInvalidMFACode      = apperror.Validation("code is incorrect", map[string]string{"code": "incorrect code"})
+	ErrTOTPAlreadyEnabled  = apperror.Conflict("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled      = apperror.Conflict("two-factor authentication is not enabled")
+	ErrTOTPNotEnrolled     = apperror.Conflict("two-factor authentication enrollment has not been started")
+)
+
+// emailVerificationAudience keeps verification tokens from being accepted
+// anywhere else the signing secret is used, and likewise for MFA challenges.
+const (
+	emailVerificationAudience = "email_verification"
+	mfaChallengeAudience      = "mfa_challenge"
+)
+
+const recoveryCodeCount = 10
+
+// emailVerificationClaims names the address being verified, so the token
+// stops working if the user changes email before following it.
+type emailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+const (
+	msgTooManyLogins      = "too many login attempts"
+	msgAccountLocked      = "too many failed login attempts"
+	msgVerificationResend = "verification email was sent recently"
+	msgPasswordReset      = "password reset email was sent recently"
+)
+
 type IUserUseCase interface {
-	SignUp(user model.User) (model.UserResponse, error)
-	LogIn(user model.User) (string, error)
+	SignUp(ctx context.Context, user model.User) (model.UserResponse, error)
+	LogIn(ctx context.Context, user model.User) (model.LoginResult, error)
+	VerifyMFA(ctx context.Context, verification model.MFAVerification) (model.TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (model.TokenPair, error)
+	LogOut(ctx context.Context, accessToken string, refreshToken string) error
+	LogOutAll(ctx context.Context, userId uint64) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, reset model.PasswordReset) error
+	GetMe(ctx context.Context, userId uint64) (model.UserResponse, error)
+	UpdateEmail(ctx context.Context, userId uint64, change model.EmailChange) (model.UserResponse, error)
+	ChangePassword(ctx context.Context, userId uint64, change model.PasswordChange) (model.TokenPair, error)
+	DeleteAccount(ctx context.Context, userId uint64, password string) error
+	EnrollTOTP(ctx context.Context, userId uint64, password string) (model.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId uint64, code string) (model.RecoveryCodes, error)
+	DisableTOTP(ctx context.Context, userId uint64, confirmation model.MFAConfirmation) error
+	RegenerateRecoveryCodes(ctx context.Context, userId uint64, confirmation model.MFAConfirmation) (model.RecoveryCodes, error)
+	// Drain waits until mail sent in the background has gone out, or ctx is
+	// done. Call it after the server stopped taking requests.
+	Drain(ctx context.Context) error
 }
 
 type userUseCase struct {
-	ur repository.IUserRepository
-	uv validator.IUserValidator
-	ph PasswordHasher
+	ur  repository.IUserRepository
+	sr  repository.ISessionRepository
+	rr  repository.IRevocationRepository
+	rl  repository.IRateLimitRepository
+	pr  repository.IPasswordResetRepository
+	mr  repository.IMFARepository
+	uv  validator.IUserValidator
+	ph  PasswordHasher
+	am  AuthMetrics
+	m   mailer.Mailer
+	cfg config.AuthConfig
+	bg  *sync.WaitGroup
+	// dummyHash is checked against for unknown emails, so they cost as much
+	// as a wrong password.
+	dummyHash func() (string, error)
 }
 
-type PasswordHasher interface {
-	GenerateFromPassword(password []byte, cost int) ([]byte, error)
+// AuthMetrics receives account events for monitoring.
+type AuthMetrics interface {
+	SignUp()
+	LogIn()
+	LogInFailure()
 }
 
-type BycryptPasswordHasher struct{}
+type noopAuthMetrics struct{}
 
-func (b *BycryptPasswordHasher) GenerateFromPassword(password []byte, cost int) ([]byte, error) {
-	return bcrypt.GenerateFromPassword(password, cost)
-}
+func (noopAuthMetrics) SignUp()       {}
+func (noopAuthMetrics) LogIn()        {}
+func (noopAuthMetrics) LogInFailure() {}
 
-func NewUserUseCase(ur repository.IUserRepository, uv validator.IUserValidator, ph PasswordHasher) IUserUseCase {
+func NewUserUseCase(ur repository.IUserRepository, sr repository.ISessionRepository, rr repository.IRevocationRepository, rl repository.IRateLimitRepository, pr repository.IPasswordResetRepository, mr repository.IMFARepository, uv validator.IUserValidator, ph PasswordHasher, am AuthMetrics, m mailer.Mailer, cfg config.AuthConfig) IUserUseCase {
 	if ph == nil {
-		ph = &BycryptPasswordHasher{}
+		ph = &BycryptPasswordHasher{Cost: bcrypt.DefaultCost}
 	}
-	return &userUseCase{ur, uv, ph}
+	if am == nil {
+		am = noopAuthMetrics{}
+	}
+	dummyHash := sync.OnceValues(func() (string, error) {
+		return ph.Hash("not anyone's password")
+	})
+	return &userUseCase{ur, sr, rr, rl, pr, mr, uv, ph, am, m, cfg, new(sync.WaitGroup), dummyHash}
 }
 
-func (uu *userUseCase) SignUp(user model.User) (model.UserResponse, error) {
+func (uu *userUseCase) SignUp(ctx context.Context, user model.User) (model.UserResponse, error) {
 	if err := uu.uv.UserValidate(user); err != nil {
 		return model.UserResponse{}, err
 	}
-	hash, err := uu.ph.GenerateFromPassword([]byte(user.Password), 10)
+	hash, err := uu.ph.Hash(user.Password)
 	if err != nil {
 		return model.UserResponse{}, err
 	}
-	newUser := model.User{Email: user.Email, Password: string(hash)}
-	if err := uu.ur.CreateUser(&newUser); err != nil {
+	newUser := model.User{Email: user.Email, Password: hash}
+	if err := uu.ur.CreateUser(ctx, &newUser); err != nil {
 		return model.UserResponse{}, err
 	}
-	resUser := model.UserResponse{ID: newUser.ID, Email: newUser.Email}
-	return resUser, nil
+	uu.am.SignUp()
+	// The account exists either way; a failed email can be resent.
+	if err := uu.sendVerification(ctx, newUser.ID, newUser.Email); err != nil {
+		slog.ErrorContext(ctx, "failed to send verification email", "error", err)
+	}
+	return newUserResponse(newUser), nil
 }
 
-func (uu *userUseCase) LogIn(user model.User) (string, error) {
+func (uu *userUseCase) LogIn(ctx context.Context, user model.User) (model.LoginResult, error) {
 	if err := uu.uv.UserValidate(user); err != nil {
-		return "", err
+		return model.LoginResult{}, err
+	}
+	// Unknown emails are limited like real accounts so the limiter doesn't
+	// reveal which addresses are registered.
+	limitKey := "login:" + strings.ToLower(user.Email)
+	if err := uu.checkLoginAllowed(ctx, limitKey); err != nil {
+		return model.LoginResult{}, err
 	}
 	storedUser := model.User{}
-	if err := uu.ur.GetUserByEmail(&storedUser, user.Email); err != nil {
-		return "", err
+	if err := uu.ur.GetUserByEmail(ctx, &storedUser, user.Email); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			// Verify anyway so unknown emails answer as slowly as real ones.
+			if hash, err := uu.dummyHash(); err == nil {
+				uu.ph.Verify(hash, user.Password)
+			}
+			return model.LoginResult{}, uu.loginFailed(ctx, limitKey)
+		}
+		return model.LoginResult{}, err
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password))
+	ok, needsRehash, err := uu.ph.Verify(storedUser.Password, user.Password)
 	if err != nil {
-		return "", err
+		return model.LoginResult{}, err
+	}
+	if !ok {
+		return model.LoginResult{}, uu.loginFailed(ctx, limitKey)
+	}
+	if needsRehash {
+		// The login already succeeded; an old hash can be upgraded next time.
+		if err := uu.rehashPassword(ctx, storedUser.ID, user.Password); err != nil {
+			slog.ErrorContext(ctx, "failed to upgrade password hash", "error", err)
+		}
+	}
+	// With two factors, failures are only forgiven once the code checks out
+	// too, or a known password would allow unlimited code guesses.
+	if storedUser.TOTPEnabledAt == nil {
+		if err := uu.rl.ResetFailures(ctx, limitKey); err != nil {
+			return model.LoginResult{}, err
+		}
+	}
+	if storedUser.EmailVerifiedAt == nil {
+		return model.LoginResult{}, ErrEmailNotVerified
+	}
+	if storedUser.TOTPEnabledAt != nil {
+		challenge, err := uu.issueMFAChallenge(storedUser.ID)
+		if err != nil {
+			return model.LoginResult{}, err
+		}
+		return model.LoginResult{Challenge: &challenge}, nil
+	}
+	tokens, err := uu.startSession(ctx, storedUser.ID)
+	if err != nil {
+		return model.LoginResult{}, err
+	}
+	uu.am.LogIn()
+	return model.LoginResult{Tokens: tokens}, nil
+}
+
+// VerifyMFA completes a login that LogIn answered with a challenge. Wrong
+// codes count towards the account's login lockout.
+func (uu *userUseCase) VerifyMFA(ctx context.Context, verification model.MFAVerification) (model.TokenPair, error) {
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(verification.MFAToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(uu.cfg.Secret.Value()), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !claims.VerifyAudience(mfaChallengeAudience, true) {
+		return model.TokenPair{}, ErrInvalidMFAToken
+	}
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return model.TokenPair{}, ErrInvalidMFAToken
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(ctx, &user, userId); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return model.TokenPair{}, ErrInvalidMFAToken
+		}
+		return model.TokenPair{}, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return model.TokenPair{}, ErrInvalidMFAToken
+	}
+	limitKey := "login:" + strings.ToLower(user.Email)
+	if err := uu.checkLoginAllowed(ctx, limitKey); err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.confirmMFACode(ctx, user, limitKey, verification.Code); err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.rl.ResetFailures(ctx, limitKey); err != nil {
+		return model.TokenPair{}, err
+	}
+	tokens, err := uu.startSession(ctx, user.ID)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	uu.am.LogIn()
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once; presenting one that was already rotated is treated as theft and
+// revokes every session descended from the same login.
+func (uu *userUseCase) Refresh(ctx context.Context, refreshToken string) (model.TokenPair, error) {
+	session := model.Session{}
+	if err := uu.sr.GetSessionByTokenHash(ctx, &session, hashToken(refreshToken)); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return model.TokenPair{}, ErrInvalidRefreshToken
+		}
+		return model.TokenPair{}, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return model.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if session.UsedAt != nil {
+		return model.TokenPair{}, uu.revokeReusedFamily(ctx, session.FamilyID)
+	}
+	nextToken, next, err := uu.newSession(session.UserID, session.FamilyID)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.sr.RotateSession(ctx, &session, &next); err != nil {
+		if errors.Is(err, repository.ErrSessionUsed) {
+			return model.TokenPair{}, uu.revokeReusedFamily(ctx, session.FamilyID)
+		}
+		return model.TokenPair{}, err
+	}
+	return uu.issueTokenPair(session.UserID, nextToken, next)
+}
+
+// LogOut revokes the given access token and the refresh token's session family.
+// Tokens that are missing, malformed or already expired are skipped, since there is nothing left to revoke.
+func (uu *userUseCase) LogOut(ctx context.Context, accessToken string, refreshToken string) error {
+	if accessToken != "" {
+		token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+			return []byte(uu.cfg.Secret.Value()), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		if err == nil {
+			claims := token.Claims.(jwt.MapClaims)
+			jti, _ := claims["jti"].(string)
+			exp, _ := claims["exp"].(float64)
+			if jti != "" {
+				if err := uu.rr.RevokeToken(ctx, jti, time.Unix(int64(exp), 0)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if refreshToken != "" {
+		session := model.Session{}
+		if err := uu.sr.GetSessionByTokenHash(ctx, &session, hashToken(refreshToken)); err == nil {
+			if err := uu.sr.RevokeSessionFamily(ctx, session.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LogOutAll invalidates every access and refresh token the user currently holds.
+func (uu *userUseCase) LogOutAll(ctx context.Context, userId uint64) error {
+	if err := uu.rr.RevokeAllForUser(ctx, userId, time.Now()); err != nil {
+		return err
+	}
+	if err := uu.sr.RevokeUserSessions(ctx, userId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// VerifyEmail marks the address in a token from sendVerification as verified.
+func (uu *userUseCase) VerifyEmail(ctx context.Context, token string) error {
+	claims := emailVerificationClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(uu.cfg.Secret.Value()), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !claims.VerifyAudience(emailVerificationAudience, true) {
+		return ErrInvalidVerification
+	}
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return ErrInvalidVerification
+	}
+	if err := uu.ur.VerifyEmail(ctx, userId, claims.Email); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return ErrInvalidVerification
+		}
+		return err
+	}
+	return nil
+}
+
+// ResendVerification mails a new verification link. It succeeds silently for
+// unknown or already verified addresses so it can't be used to probe accounts.
+func (uu *userUseCase) ResendVerification(ctx context.Context, email string) error {
+	wait, err := uu.rl.Take(ctx, "verify:"+strings.ToLower(email), 1, uu.cfg.VerificationResendInterval)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return apperror.TooManyRequests(msgVerificationResend, wait)
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByEmail(ctx, &user, email); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return uu.sendVerification(ctx, user.ID, user.Email)
+}
+
+// sendVerification mails a link verifying email, the user's address or the
+// one they are moving to.
+func (uu *userUseCase) sendVerification(ctx context.Context, userId uint64, email string) error {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, emailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(userId, 10),
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(uu.cfg.VerificationTokenTTL)),
+		},
+	})
+	tokenString, err := token.SignedString([]byte(uu.cfg.Secret.Value()))
+	if err != nil {
+		return err
+	}
+	link := uu.cfg.VerificationURL + "?token=" + url.QueryEscape(tokenString)
+	return uu.m.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    "Follow this link to verify your email address:\n\n" + link + "\n\nThe link expires in " + uu.cfg.VerificationTokenTTL.String() + ".\n",
+	})
+}
+
+// ForgotPassword mails a single-use reset link. Like ResendVerification it
+// reports success for unknown addresses so accounts can't be enumerated.
+func (uu *userUseCase) ForgotPassword(ctx context.Context, email string) error {
+	wait, err := uu.rl.Take(ctx, "reset:"+strings.ToLower(email), 1, uu.cfg.PasswordResetInterval)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return apperror.TooManyRequests(msgPasswordReset, wait)
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByEmail(ctx, &user, email); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return nil
+		}
+		return err
+	}
+	// The link is stored and mailed in the background, so a real account
+	// answers as fast as an unknown address and a failed send can't give it
+	// away either.
+	ctx = context.WithoutCancel(ctx)
+	uu.bg.Add(1)
+	go func() {
+		defer uu.bg.Done()
+		if err := uu.sendPasswordReset(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "failed to send password reset email", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (uu *userUseCase) Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		uu.bg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (uu *userUseCase) sendPasswordReset(ctx context.Context, user model.User) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	resetToken := model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(uu.cfg.PasswordResetTokenTTL),
+	}
+	if err := uu.pr.CreateResetToken(ctx, &resetToken); err != nil {
+		return err
+	}
+	link := uu.cfg.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	return uu.m.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    "Follow this link to choose a new password:\n\n" + link + "\n\nThe link expires in " + uu.cfg.PasswordResetTokenTTL.String() + ". If you didn't ask for a reset, you can ignore this email.\n",
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword, then
+// signs the user out everywhere and lifts any login lockout.
+func (uu *userUseCase) ResetPassword(ctx context.Context, reset model.PasswordReset) error {
+	if err := uu.uv.PasswordValidate(reset.Password); err != nil {
+		return err
+	}
+	if reset.Token == "" {
+		return ErrInvalidResetToken
+	}
+	hash, err := uu.ph.Hash(reset.Password)
+	if err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.pr.ResetPassword(ctx, &user, hashToken(reset.Token), hash); err != nil {
+		if apperror.KindOf(err) == apperror.KindNotFound {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if err := uu.LogOutAll(ctx, user.ID); err != nil {
+		return err
+	}
+	return uu.rl.ResetFailures(ctx, "login:"+strings.ToLower(user.Email))
+}
+
+func (uu *userUseCase) GetMe(ctx context.Context, userId uint64) (model.UserResponse, error) {
+	user := model.User{}
+	if err := uu.ur.GetUserByID(ctx, &user, userId); err != nil {
+		return model.UserResponse{}, err
+	}
+	return newUserResponse(user), nil
+}
+
+// UpdateEmail starts moving the account to a new address. The old address
+// stays in use, for logging in too, until the link mailed to the new one is
+// followed. Asking for the current address cancels a pending move.
+func (uu *userUseCase) UpdateEmail(ctx context.Context, userId uint64, change model.EmailChange) (model.UserResponse, error) {
+	if err := uu.uv.EmailValidate(change.Email); err != nil {
+		return model.UserResponse{}, err
+	}
+	user := model.User{}
+	if err := uu.confirmPassword(ctx, &user, userId, change.Password); err != nil {
+		return model.UserResponse{}, err
+	}
+	if user.Email == change.Email {
+		if user.PendingEmail != "" {
+			if err := uu.ur.SetPendingEmail(ctx, &user, userId, ""); err != nil {
+				return model.UserResponse{}, err
+			}
+		}
+		return newUserResponse(user), nil
+	}
+	if err := uu.ur.SetPendingEmail(ctx, &user, userId, change.Email); err != nil {
+		return model.UserResponse{}, err
+	}
+	if err := uu.sendVerification(ctx, user.ID, user.PendingEmail); err != nil {
+		slog.ErrorContext(ctx, "failed to send verification email", "error", err)
+	}
+	return newUserResponse(user), nil
+}
+
+// ChangePassword replaces the password, signs out every other session and
+// returns a fresh token pair for the caller.
+func (uu *userUseCase) ChangePassword(ctx context.Context, userId uint64, change model.PasswordChange) (model.TokenPair, error) {
+	if err := uu.uv.PasswordValidate(change.NewPassword); err != nil {
+		return model.TokenPair{}, err
+	}
+	user := model.User{}
+	if err := uu.confirmPassword(ctx, &user, userId, change.CurrentPassword); err != nil {
+		return model.TokenPair{}, err
+	}
+	hash, err := uu.ph.Hash(change.NewPassword)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.ur.UpdatePassword(ctx, userId, hash); err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.LogOutAll(ctx, userId); err != nil {
+		return model.TokenPair{}, err
 	}
+	return uu.startSession(ctx, userId)
+}
+
+// DeleteAccount signs the user out everywhere before deleting them, so access
+// tokens held by their other devices stop working too. Shared projects must
+// have another owner first, which is checked before anyone is signed out.
+func (uu *userUseCase) DeleteAccount(ctx context.Context, userId uint64, password string) error {
+	user := model.User{}
+	if err := uu.confirmPassword(ctx, &user, userId, password); err != nil {
+		return err
+	}
+	if err := uu.ur.CheckDeletable(ctx, userId); err != nil {
+		return err
+	}
+	if err := uu.LogOutAll(ctx, userId); err != nil {
+		return err
+	}
+	return uu.ur.DeleteUser(ctx, userId)
+}
+
+// EnrollTOTP starts two-factor enrollment with a new secret. It takes effect
+// once ConfirmTOTP sees a code generated from it.
+func (uu *userUseCase) EnrollTOTP(ctx context.Context, userId uint64, password string) (model.TOTPEnrollment, error) {
+	user := model.User{}
+	if err := uu.confirmPassword(ctx, &user, userId, password); err != nil {
+		return model.TOTPEnrollment{}, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return model.TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return model.TOTPEnrollment{}, err
+	}
+	if err := uu.mr.SetTOTPSecret(ctx, userId, secret); err != nil {
+		return model.TOTPEnrollment{}, err
+	}
+	return model.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(uu.cfg.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP turns two-factor authentication on and returns the recovery
+// codes, which are only ever shown here and by RegenerateRecoveryCodes.
+func (uu *userUseCase) ConfirmTOTP(ctx context.Context, userId uint64, code string) (model.RecoveryCodes, error) {
+	user := model.User{}
+	if err := uu.ur.GetUserByID(ctx, &user, userId); err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return model.RecoveryCodes{}, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return model.RecoveryCodes{}, ErrTOTPNotEnrolled
+	}
+	step, ok, err := totp.Validate(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+	if err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	if !ok {
+		return model.RecoveryCodes{}, ErrInvalidMFACode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	if err := uu.mr.EnableTOTP(ctx, userId, step, hashes); err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	return model.RecoveryCodes{Codes: codes}, nil
+}
+
+func (uu *userUseCase) DisableTOTP(ctx context.Context, userId uint64, confirmation model.MFAConfirmation) error {
+	user := model.User{}
+	if err := uu.confirmBothFactors(ctx, &user, userId, confirmation); err != nil {
+		return err
+	}
+	return uu.mr.DisableTOTP(ctx, userId)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (uu *userUseCase) RegenerateRecoveryCodes(ctx context.Context, userId uint64, confirmation model.MFAConfirmation) (model.RecoveryCodes, error) {
+	user := model.User{}
+	if err := uu.confirmBothFactors(ctx, &user, userId, confirmation); err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	if err := uu.mr.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return model.RecoveryCodes{}, err
+	}
+	return model.RecoveryCodes{Codes: codes}, nil
+}
+
+// confirmBothFactors checks the password and a TOTP or recovery code of a
+// user with two-factor authentication on, forgiving earlier failures only once
+// both check out.
+func (uu *userUseCase) confirmBothFactors(ctx context.Context, user *model.User, userId uint64, confirmation model.MFAConfirmation) error {
+	if err := uu.confirmPassword(ctx, user, userId, confirmation.Password); err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return ErrTOTPNotEnabled
+	}
+	limitKey := "login:" + strings.ToLower(user.Email)
+	if err := uu.confirmMFACode(ctx, *user, limitKey, confirmation.Code); err != nil {
+		return err
+	}
+	return uu.rl.ResetFailures(ctx, limitKey)
+}
+
+// confirmMFACode spends code, a TOTP code or recovery code, recording a
+// login failure under limitKey when it is wrong.
+func (uu *userUseCase) confirmMFACode(ctx context.Context, user model.User, limitKey string, code string) error {
+	ok, err := uu.useMFACode(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := uu.loginFailed(ctx, limitKey); !errors.Is(err, ErrInvalidCredentials) {
+			return err
+		}
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// useMFACode accepts a TOTP code newer than the last one accepted, or an
+// unused recovery code, and marks it used.
+func (uu *userUseCase) useMFACode(ctx context.Context, user model.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	step, ok, err := totp.Validate(user.TOTPSecret, code, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		err = uu.mr.UseTOTPStep(ctx, user.ID, step)
+	} else {
+		err = uu.mr.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	}
+	if apperror.KindOf(err) == apperror.KindNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// confirmPassword loads the user and checks password against it. Wrong
+// guesses count towards the same lockout as failed logins. As in LogIn, a
+// correct password alone only forgives them for users without two-factor
+// authentication; otherwise that is left to confirmBothFactors.
+func (uu *userUseCase) confirmPassword(ctx context.Context, user *model.User, userId uint64, password string) error {
+	if err := uu.ur.GetUserByID(ctx, user, userId); err != nil {
+		return err
+	}
+	limitKey := "login:" + strings.ToLower(user.Email)
+	if err := uu.checkLoginAllowed(ctx, limitKey); err != nil {
+		return err
+	}
+	ok, _, err := uu.ph.Verify(user.Password, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := uu.loginFailed(ctx, limitKey); !errors.Is(err, ErrInvalidCredentials) {
+			return err
+		}
+		return ErrIncorrectPassword
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil
+	}
+	return uu.rl.ResetFailures(ctx, limitKey)
+}
+
+// checkLoginAllowed refuses the attempt while the account is locked out or
+// its attempt bucket is empty, before any password hashing is done.
+func (uu *userUseCase) checkLoginAllowed(ctx context.Context, key string) error {
+	failure := model.LoginFailure{}
+	if err := uu.rl.GetFailures(ctx, &failure, key); err != nil {
+		return err
+	}
+	if wait := time.Until(uu.lockedUntil(failure)); wait > 0 {
+		return apperror.TooManyRequests(msgAccountLocked, wait)
+	}
+	if uu.cfg.LoginBurst <= 0 {
+		return nil
+	}
+	wait, err := uu.rl.Take(ctx, key, uu.cfg.LoginBurst, uu.cfg.LoginInterval)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return apperror.TooManyRequests(msgTooManyLogins, wait)
+	}
+	return nil
+}
+
+// loginFailed records the failure and returns ErrInvalidCredentials, or a
+// lockout error once this failure crosses the threshold.
+func (uu *userUseCase) loginFailed(ctx context.Context, key string) error {
+	uu.am.LogInFailure()
+	failure := model.LoginFailure{}
+	if err := uu.rl.RecordFailure(ctx, &failure, key, uu.cfg.FailureWindow); err != nil {
+		return err
+	}
+	if wait := time.Until(uu.lockedUntil(failure)); wait > 0 {
+		return apperror.TooManyRequests(msgAccountLocked, wait)
+	}
+	return ErrInvalidCredentials
+}
+
+// lockedUntil doubles the lockout for every failure past the threshold.
+func (uu *userUseCase) lockedUntil(failure model.LoginFailure) time.Time {
+	if uu.cfg.LockoutThreshold <= 0 || failure.Count < uu.cfg.LockoutThreshold {
+		return time.Time{}
+	}
+	lockout := uu.cfg.LockoutDuration
+	for i := uu.cfg.LockoutThreshold; i < failure.Count && lockout < uu.cfg.MaxLockoutDuration; i++ {
+		lockout *= 2
+	}
+	if lockout > uu.cfg.MaxLockoutDuration {
+		lockout = uu.cfg.MaxLockoutDuration
+	}
+	return failure.LastFailedAt.Add(lockout)
+}
+
+// issueMFAChallenge signs the token that stands for a correct password until
+// the second factor is given.
+func (uu *userUseCase) issueMFAChallenge(userId uint64) (model.MFAChallenge, error) {
+	now := time.Now()
+	expiresAt := now.Add(uu.cfg.MFAChallengeTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(userId, 10),
+		Audience:  jwt.ClaimStrings{mfaChallengeAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+	tokenString, err := token.SignedString([]byte(uu.cfg.Secret.Value()))
+	if err != nil {
+		return model.MFAChallenge{}, err
+	}
+	return model.MFAChallenge{MFAToken: tokenString, ExpiresAt: expiresAt}, nil
+}
+
+func (uu *userUseCase) revokeReusedFamily(ctx context.Context, familyId string) error {
+	if err := uu.sr.RevokeSessionFamily(ctx, familyId); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (uu *userUseCase) issueTokenPair(userId uint64, refreshToken string, session model.Session) (model.TokenPair, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(uu.cfg.AccessTokenTTL)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": storedUser.ID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"user_id": userId,
+		"jti":     jti,
+		// Millisecond precision so a login right after LogOutAll isn't caught by its cutoff.
+		"iat": float64(now.UnixMilli()) / 1000,
+		"exp": expiresAt.Unix(),
 	})
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokenString, err := token.SignedString([]byte(uu.cfg.Secret.Value()))
 	if err != nil {
+		return model.TokenPair{}, err
+	}
+	return model.TokenPair{
+		AccessToken:           tokenString,
+		AccessTokenExpiresAt:  expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// startSession opens a new session family and issues its first token pair.
+func (uu *userUseCase) startSession(ctx context.Context, userId uint64) (model.TokenPair, error) {
+	familyId, err := randomToken()
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	refreshToken, session, err := uu.newSession(userId, familyId)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+	if err := uu.sr.CreateSession(ctx, &session); err != nil {
+		return model.TokenPair{}, err
+	}
+	return uu.issueTokenPair(userId, refreshToken, session)
+}
+
+// newSession mints a refresh token and the session row that stores its hash.
+func (uu *userUseCase) newSession(userId uint64, familyId string) (string, model.Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", model.Session{}, err
+	}
+	session := model.Session{
+		UserID:    userId,
+		FamilyID:  familyId,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(uu.cfg.RefreshTokenTTL),
+	}
+	return token, session, nil
+}
+
+// rehashPassword stores password under the hasher's current algorithm and
+// parameters.
+func (uu *userUseCase) rehashPassword(ctx context.Context, userId uint64, password string) error {
+	hash, err := uu.ph.Hash(password)
+	if err != nil {
+		return err
+	}
+	return uu.ur.UpdatePassword(ctx, userId, hash)
+}
+
+func newUserResponse(user model.User) model.UserResponse {
+	return model.UserResponse{
+		ID:               user.ID,
+		Email:            user.Email,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+		PendingEmail:     user.PendingEmail,
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return tokenString, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newRecoveryCodes returns codes formatted for the user, as xxxxx-xxxxx, and
+// the hashes to store.
+func newRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	b := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := make([]byte, len(b))
+		for j, c := range b {
+			code[j] = alphabet[c%32]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		hashes[i] = hashToken(string(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting of newRecoveryCodes, and any
+// the user added.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
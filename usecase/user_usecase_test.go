@@ -1,13 +1,19 @@
 package usecase_test
 
 import (
+	"context"
 	"errors"
+	"go-rest-api/apperror"
+	"go-rest-api/config"
+	"go-rest-api/mailer"
 	"go-rest-api/model"
-	"os"
-
-	// "go-rest-api/repository"
+	"go-rest-api/repository"
+	"go-rest-api/totp"
 	"go-rest-api/usecase"
+	"net/url"
+	"regexp"
 	"testing"
+	"time"
 
 	// "github.com/golang-jwt/jwt/v4"
 	"github.com/golang-jwt/jwt/v4"
@@ -16,6 +22,17 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var verifiedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var authConfig = config.AuthConfig{
+	Secret:               "secret",
+	AccessTokenTTL:       15 * time.Minute,
+	RefreshTokenTTL:      time.Hour,
+	VerificationURL:      "http://localhost:8080/verify",
+	VerificationTokenTTL: time.Hour,
+	MFAChallengeTTL:      5 * time.Minute,
+}
+
 type mockUserRepository struct {
 	mock.Mock
 }
@@ -24,21 +41,90 @@ type mockUserValidator struct {
 	mock.Mock
 }
 
+type mockSessionRepository struct {
+	mock.Mock
+}
+
+type mockPasswordResetRepository struct {
+	mock.Mock
+}
+
+type mockMailer struct {
+	mock.Mock
+}
+
 type mockPasswordHasher struct {
 	mock.Mock
 }
 
-func (m *mockPasswordHasher) GenerateFromPassword(password []byte, cost int) ([]byte, error) {
-	args := m.Called(password, cost)
-	return args.Get(0).([]byte), args.Error(1)
+type mockMFARepository struct {
+	mock.Mock
+}
+
+func (m *mockMFARepository) SetTOTPSecret(ctx context.Context, userId uint64, secret string) error {
+	args := m.Called(userId, secret)
+	return args.Error(0)
+}
+
+func (m *mockMFARepository) EnableTOTP(ctx context.Context, userId uint64, step int64, codeHashes []string) error {
+	args := m.Called(userId, step, codeHashes)
+	return args.Error(0)
+}
+
+func (m *mockMFARepository) DisableTOTP(ctx context.Context, userId uint64) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
+func (m *mockMFARepository) UseTOTPStep(ctx context.Context, userId uint64, step int64) error {
+	args := m.Called(userId, step)
+	return args.Error(0)
+}
+
+func (m *mockMFARepository) ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error {
+	args := m.Called(userId, codeHashes)
+	return args.Error(0)
+}
+
+func (m *mockMFARepository) UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error {
+	args := m.Called(userId, codeHash)
+	return args.Error(0)
 }
 
-func (m *mockUserRepository) CreateUser(user *model.User) error {
+func (m *mockPasswordResetRepository) CreateResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *mockPasswordResetRepository) ResetPassword(ctx context.Context, user *model.User, tokenHash string, passwordHash string) error {
+	args := m.Called(user, tokenHash, passwordHash)
+	if args.Get(0) != nil {
+		*user = args.Get(0).(model.User)
+	}
+	return args.Error(1)
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg mailer.Message) error {
+	args := m.Called(msg)
+	return args.Error(0)
+}
+
+func (m *mockPasswordHasher) Hash(password string) (string, error) {
+	args := m.Called(password)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockPasswordHasher) Verify(hash string, password string) (bool, bool, error) {
+	args := m.Called(hash, password)
+	return args.Bool(0), args.Bool(1), args.Error(2)
+}
+
+func (m *mockUserRepository) CreateUser(ctx context.Context, user *model.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
-func (m *mockUserRepository) GetUserByEmail(user *model.User, email string) error {
+func (m *mockUserRepository) GetUserByEmail(ctx context.Context, user *model.User, email string) error {
 	args := m.Called(user, email)
 	if args.Get(0) != nil {
 		*user = args.Get(0).(model.User)
@@ -46,43 +132,183 @@ func (m *mockUserRepository) GetUserByEmail(user *model.User, email string) erro
 	return args.Error(1)
 }
 
+func (m *mockUserRepository) VerifyEmail(ctx context.Context, userId uint64, email string) error {
+	args := m.Called(userId, email)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) GetUserByID(ctx context.Context, user *model.User, userId uint64) error {
+	args := m.Called(user, userId)
+	if args.Get(0) != nil {
+		*user = args.Get(0).(model.User)
+	}
+	return args.Error(1)
+}
+
+func (m *mockUserRepository) SetPendingEmail(ctx context.Context, user *model.User, userId uint64, email string) error {
+	args := m.Called(user, userId, email)
+	if args.Get(0) != nil {
+		*user = args.Get(0).(model.User)
+	}
+	return args.Error(1)
+}
+
+func (m *mockUserRepository) UpdatePassword(ctx context.Context, userId uint64, passwordHash string) error {
+	args := m.Called(userId, passwordHash)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) CheckDeletable(ctx context.Context, userId uint64) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
+func (m *mockUserRepository) DeleteUser(ctx context.Context, userId uint64) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
+func (m *mockSessionRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *mockSessionRepository) GetSessionByTokenHash(ctx context.Context, session *model.Session, tokenHash string) error {
+	args := m.Called(session, tokenHash)
+	if args.Get(0) != nil {
+		*session = args.Get(0).(model.Session)
+	}
+	return args.Error(1)
+}
+
+func (m *mockSessionRepository) RotateSession(ctx context.Context, current *model.Session, next *model.Session) error {
+	args := m.Called(current, next)
+	return args.Error(0)
+}
+
+func (m *mockSessionRepository) RevokeSessionFamily(ctx context.Context, familyId string) error {
+	args := m.Called(familyId)
+	return args.Error(0)
+}
+
+func (m *mockSessionRepository) RevokeUserSessions(ctx context.Context, userId uint64) error {
+	args := m.Called(userId)
+	return args.Error(0)
+}
+
 func (m *mockUserValidator) UserValidate(user model.User) error {
 	args := m.Called(user)
 	return args.Error(0)
 }
 
+func (m *mockUserValidator) EmailValidate(email string) error {
+	args := m.Called(email)
+	return args.Error(0)
+}
+
+func (m *mockUserValidator) PasswordValidate(password string) error {
+	args := m.Called(password)
+	return args.Error(0)
+}
+
 func TestSignUpSuccess(t *testing.T) {
 	mockUserRepository := new(mockUserRepository)
 	mockUserValidator := new(mockUserValidator)
 	mockPasswordHasher := new(mockPasswordHasher)
-	uc := usecase.NewUserUseCase(mockUserRepository, mockUserValidator, mockPasswordHasher)
+	mockMailer := new(mockMailer)
+	uc := usecase.NewUserUseCase(mockUserRepository, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValidator, mockPasswordHasher, nil, mockMailer, authConfig)
 	user := model.User{
 		Email:    "test@example.com",
 		Password: "password",
 	}
 
-	mockPasswordHasher.On("GenerateFromPassword", []byte(user.Password), 10).Return([]byte("HashedPasswordShouldBeHere"), nil)
+	mockPasswordHasher.On("Hash", user.Password).Return("HashedPasswordShouldBeHere", nil)
 	mockUserValidator.On("UserValidate", user).Return(nil)
-	mockUserRepository.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil)
-	_, err := uc.SignUp(user)
+	mockUserRepository.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*model.User).ID = 1
+	})
+	var sent mailer.Message
+	mockMailer.On("Send", mock.AnythingOfType("mailer.Message")).Return(nil).Run(func(args mock.Arguments) {
+		sent = args.Get(0).(mailer.Message)
+	})
+	_, err := uc.SignUp(context.Background(), user)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Email, sent.To)
+
+	// The mailed link verifies the address it was sent to.
+	token := regexp.MustCompile(`\?token=(\S+)`).FindStringSubmatch(sent.Body)
+	if assert.Len(t, token, 2) {
+		mockUserRepository.On("VerifyEmail", uint64(1), user.Email).Return(nil)
+		assert.NoError(t, uc.VerifyEmail(context.Background(), token[1]))
+		mockUserRepository.AssertExpectations(t)
+	}
+}
+
+func TestVerifyEmailRejectsAccessToken(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(model.User{ID: 1, Email: user.Email, Password: string(hash), EmailVerifiedAt: &verifiedAt}, nil)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	result, err := uc.LogIn(context.Background(), user)
+	tokens := result.Tokens
 	assert.NoError(t, err)
+
+	err = uc.VerifyEmail(context.Background(), tokens.AccessToken)
+	assert.ErrorIs(t, err, usecase.ErrInvalidVerification)
+	mockUserRepo.AssertNotCalled(t, "VerifyEmail", mock.Anything, mock.Anything)
+}
+
+func TestLogInRefusesUnverifiedEmail(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(model.User{ID: 1, Email: user.Email, Password: string(hash)}, nil)
+	_, err := uc.LogIn(context.Background(), user)
+	assert.ErrorIs(t, err, usecase.ErrEmailNotVerified)
+	mockSessionRepo.AssertNotCalled(t, "CreateSession", mock.Anything)
+}
+
+func TestResendVerificationIsThrottledAndSilentForUnknownEmail(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockMailer := new(mockMailer)
+	cfg := authConfig
+	cfg.VerificationResendInterval = time.Minute
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, mockMailer, cfg)
+
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "nobody@example.com").Return(nil, apperror.NotFound("user not found"))
+	assert.NoError(t, uc.ResendVerification(context.Background(), "nobody@example.com"))
+	mockMailer.AssertNotCalled(t, "Send", mock.Anything)
+
+	err := uc.ResendVerification(context.Background(), "nobody@example.com")
+	assert.Equal(t, apperror.KindTooManyRequests, apperror.KindOf(err))
 }
 
 func TestSignUpPasswordHasherFaild(t *testing.T) {
 	mockUserRepository := new(mockUserRepository)
 	mockUserValidator := new(mockUserValidator)
 	mockPasswordHasher := new(mockPasswordHasher)
-	uc := usecase.NewUserUseCase(mockUserRepository, mockUserValidator, mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepository, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValidator, mockPasswordHasher, nil, new(mockMailer), authConfig)
 	user := model.User{
 		Email:    "test@example.com",
 		Password: "password",
 	}
 
 	mockError := errors.New("PasswordHasher failed")
-	mockPasswordHasher.On("GenerateFromPassword", []byte(user.Password), 10).Return([]byte(""), mockError)
+	mockPasswordHasher.On("Hash", user.Password).Return("", mockError)
 	mockUserValidator.On("UserValidate", user).Return(nil)
 	mockUserRepository.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil)
-	_, err := uc.SignUp(user)
+	_, err := uc.SignUp(context.Background(), user)
 	assert.Error(t, err)
 	assert.Equal(t, mockError, err)
 }
@@ -91,17 +317,17 @@ func TestSignUpCreateUserFaild(t *testing.T) {
 	mockUserRepository := new(mockUserRepository)
 	mockUserValidator := new(mockUserValidator)
 	mockPasswordHasher := new(mockPasswordHasher)
-	uc := usecase.NewUserUseCase(mockUserRepository, mockUserValidator, mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepository, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValidator, mockPasswordHasher, nil, new(mockMailer), authConfig)
 	user := model.User{
 		Email:    "test@example.com",
 		Password: "password",
 	}
 
 	mockError := errors.New("CreateUser failed")
-	mockPasswordHasher.On("GenerateFromPassword", []byte(user.Password), 10).Return([]byte("HashedPasswordShouldBeHere"), nil)
+	mockPasswordHasher.On("Hash", user.Password).Return("HashedPasswordShouldBeHere", nil)
 	mockUserValidator.On("UserValidate", user).Return(nil)
 	mockUserRepository.On("CreateUser", mock.AnythingOfType("*model.User")).Return(mockError)
-	_, err := uc.SignUp(user)
+	_, err := uc.SignUp(context.Background(), user)
 	assert.Error(t, err)
 	assert.Equal(t, mockError, err)
 }
@@ -110,17 +336,17 @@ func TestSignUpValidationFaild(t *testing.T) {
 	mockUserRepository := new(mockUserRepository)
 	mockUserValidator := new(mockUserValidator)
 	mockPasswordHasher := new(mockPasswordHasher)
-	uc := usecase.NewUserUseCase(mockUserRepository, mockUserValidator, mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepository, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValidator, mockPasswordHasher, nil, new(mockMailer), authConfig)
 	user := model.User{
 		Email:    "test@example.com",
 		Password: "password",
 	}
 
 	mockError := errors.New("Validation failed")
-	mockPasswordHasher.On("GenerateFromPassword", []byte(user.Password), 10).Return([]byte("HashedPasswordShouldBeHere"), nil)
+	mockPasswordHasher.On("Hash", user.Password).Return("HashedPasswordShouldBeHere", nil)
 	mockUserValidator.On("UserValidate", user).Return(mockError)
 	mockUserRepository.On("CreateUser", mock.AnythingOfType("*model.User")).Return(nil)
-	_, err := uc.SignUp(user)
+	_, err := uc.SignUp(context.Background(), user)
 	assert.Error(t, err)
 	assert.Equal(t, mockError, err)
 }
@@ -128,8 +354,9 @@ func TestSignUpValidationFaild(t *testing.T) {
 func TestLogInSuccess(t *testing.T) {
 	mockPasswordHasher := new(mockPasswordHasher)
 	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
 	mockUserValid := new(mockUserValidator)
-	uc := usecase.NewUserUseCase(mockUserRepo, mockUserValid, mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
 	user := model.User{
 		ID:       1,
 		Email:    "test@example.com",
@@ -137,28 +364,58 @@ func TestLogInSuccess(t *testing.T) {
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
 	storedUser := model.User{
-		ID:       1,
-		Email:    "test@example.com",
-		Password: string(hash),
+		ID:              1,
+		Email:           "test@example.com",
+		Password:        string(hash),
+		EmailVerifiedAt: &verifiedAt,
 	}
 
 	mockUserValid.On("UserValidate", user).Return(nil)
 	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(storedUser, nil)
-	tokenString, err := uc.LogIn(user)
+	mockPasswordHasher.On("Verify", storedUser.Password, user.Password).Return(true, false, nil)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	result, err := uc.LogIn(context.Background(), user)
+	tokens := result.Tokens
 	assert.NoError(t, err)
-	parsedToken, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("SECRET")), nil
+	assert.NotEmpty(t, tokens.RefreshToken)
+	mockUserRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+	mockSessionRepo.AssertCalled(t, "CreateSession", mock.MatchedBy(func(s *model.Session) bool {
+		return s.UserID == storedUser.ID && s.TokenHash != tokens.RefreshToken && s.FamilyID != ""
+	}))
+	parsedToken, _ := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
+		return []byte(authConfig.Secret.Value()), nil
 	})
 	claims := parsedToken.Claims.(jwt.MapClaims)
 	assert.Equal(t, float64(storedUser.ID), claims["user_id"])
 
 }
 
+func TestLogInUpgradesOutdatedHash(t *testing.T) {
+	mockPasswordHasher := new(mockPasswordHasher)
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	mockUserValid := new(mockUserValidator)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "password"}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(model.User{ID: 1, Email: user.Email, Password: "old-hash", EmailVerifiedAt: &verifiedAt}, nil)
+	mockPasswordHasher.On("Verify", "old-hash", user.Password).Return(true, true, nil)
+	mockPasswordHasher.On("Hash", user.Password).Return("new-hash", nil)
+	mockUserRepo.On("UpdatePassword", uint64(1), "new-hash").Return(errors.New("UpdatePassword failed"))
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	// A failed upgrade doesn't fail the login.
+	_, err := uc.LogIn(context.Background(), user)
+	assert.NoError(t, err)
+	mockUserRepo.AssertCalled(t, "UpdatePassword", uint64(1), "new-hash")
+}
+
 func TestLogInGetUserByEmailFaild(t *testing.T) {
 	mockPasswordHasher := new(mockPasswordHasher)
 	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
 	mockUserValid := new(mockUserValidator)
-	uc := usecase.NewUserUseCase(mockUserRepo, mockUserValid, mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
 	user := model.User{
 		ID:       1,
 		Email:    "test@example.com",
@@ -166,15 +423,530 @@ func TestLogInGetUserByEmailFaild(t *testing.T) {
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
 	storedUser := model.User{
-		ID:       1,
-		Email:    "test@example.com",
-		Password: string(hash),
+		ID:              1,
+		Email:           "test@example.com",
+		Password:        string(hash),
+		EmailVerifiedAt: &verifiedAt,
 	}
 
 	mockError := errors.New("GetUserByEmail failed")
 	mockUserValid.On("UserValidate", user).Return(nil)
 	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(storedUser, mockError)
-	_, err := uc.LogIn(user)
+	_, err := uc.LogIn(context.Background(), user)
 	assert.Error(t, err)
 	assert.Equal(t, mockError, err)
 }
+
+func TestRefreshRotatesSession(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	storedSession := model.Session{
+		ID:        1,
+		UserID:    1,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	mockSessionRepo.On("GetSessionByTokenHash", mock.AnythingOfType("*model.Session"), mock.AnythingOfType("string")).Return(storedSession, nil)
+	mockSessionRepo.On("RotateSession", mock.AnythingOfType("*model.Session"), mock.MatchedBy(func(s *model.Session) bool {
+		return s.UserID == storedSession.UserID && s.FamilyID == storedSession.FamilyID
+	})).Return(nil)
+	tokens, err := uc.Refresh(context.Background(), "refresh-token")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEqual(t, "refresh-token", tokens.RefreshToken)
+	mockSessionRepo.AssertNotCalled(t, "RevokeSessionFamily", mock.Anything)
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	usedAt := time.Now().Add(-time.Minute)
+	storedSession := model.Session{
+		ID:        1,
+		UserID:    1,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+		UsedAt:    &usedAt,
+	}
+
+	mockSessionRepo.On("GetSessionByTokenHash", mock.AnythingOfType("*model.Session"), mock.AnythingOfType("string")).Return(storedSession, nil)
+	mockSessionRepo.On("RevokeSessionFamily", "family").Return(nil)
+	_, err := uc.Refresh(context.Background(), "refresh-token")
+	assert.Equal(t, usecase.ErrRefreshTokenReused, err)
+	mockSessionRepo.AssertCalled(t, "RevokeSessionFamily", "family")
+	mockSessionRepo.AssertNotCalled(t, "RotateSession", mock.Anything, mock.Anything)
+}
+
+func TestRefreshConcurrentRotationRevokesFamily(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	storedSession := model.Session{
+		ID:        1,
+		UserID:    1,
+		FamilyID:  "family",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	mockSessionRepo.On("GetSessionByTokenHash", mock.AnythingOfType("*model.Session"), mock.AnythingOfType("string")).Return(storedSession, nil)
+	mockSessionRepo.On("RotateSession", mock.Anything, mock.Anything).Return(repository.ErrSessionUsed)
+	mockSessionRepo.On("RevokeSessionFamily", "family").Return(nil)
+	_, err := uc.Refresh(context.Background(), "refresh-token")
+	assert.Equal(t, usecase.ErrRefreshTokenReused, err)
+	mockSessionRepo.AssertCalled(t, "RevokeSessionFamily", "family")
+}
+
+func TestLogOutRevokesTokens(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	mockUserValid := new(mockUserValidator)
+	revocationRepo := repository.NewMemoryRevocationRepository()
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, revocationRepo, repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
+	storedUser := model.User{ID: 1, Email: user.Email, Password: string(hash), EmailVerifiedAt: &verifiedAt}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(storedUser, nil)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	result, err := uc.LogIn(context.Background(), user)
+	tokens := result.Tokens
+	assert.NoError(t, err)
+	parsedToken, _ := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
+		return []byte(authConfig.Secret.Value()), nil
+	})
+	claims := parsedToken.Claims.(jwt.MapClaims)
+	jti := claims["jti"].(string)
+	issuedAt := time.UnixMilli(int64(claims["iat"].(float64) * 1000))
+
+	mockSessionRepo.On("GetSessionByTokenHash", mock.AnythingOfType("*model.Session"), mock.AnythingOfType("string")).Return(model.Session{FamilyID: "family"}, nil)
+	mockSessionRepo.On("RevokeSessionFamily", "family").Return(nil)
+	assert.NoError(t, uc.LogOut(context.Background(), tokens.AccessToken, tokens.RefreshToken))
+	revoked, err := revocationRepo.IsRevoked(context.Background(), jti, storedUser.ID, issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	mockSessionRepo.AssertCalled(t, "RevokeSessionFamily", "family")
+}
+
+func TestLogOutAllRevokesEarlierTokens(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	revocationRepo := repository.NewMemoryRevocationRepository()
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, revocationRepo, repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	mockSessionRepo.On("RevokeUserSessions", uint64(1)).Return(nil)
+	assert.NoError(t, uc.LogOutAll(context.Background(), 1))
+	revoked, _ := revocationRepo.IsRevoked(context.Background(), "old", 1, issuedAt)
+	assert.True(t, revoked)
+	revoked, _ = revocationRepo.IsRevoked(context.Background(), "new", 1, time.Now().Add(time.Second))
+	assert.False(t, revoked)
+	revoked, _ = revocationRepo.IsRevoked(context.Background(), "other-user", 2, issuedAt)
+	assert.False(t, revoked)
+	mockSessionRepo.AssertCalled(t, "RevokeUserSessions", uint64(1))
+}
+
+func TestLogInWrongPassword(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "wrong-password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	storedUser := model.User{ID: 1, Email: user.Email, Password: string(hash), EmailVerifiedAt: &verifiedAt}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(storedUser, nil)
+	_, err := uc.LogIn(context.Background(), user)
+	assert.Equal(t, usecase.ErrInvalidCredentials, err)
+	assert.Equal(t, apperror.KindUnauthorized, apperror.KindOf(err))
+}
+
+func TestLogInVerifiesPasswordForUnknownEmail(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	mockPasswordHasher := new(mockPasswordHasher)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "nobody@example.com", Password: "password"}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(nil, apperror.NotFound("user not found"))
+	mockPasswordHasher.On("Hash", mock.AnythingOfType("string")).Return("dummy-hash", nil)
+	mockPasswordHasher.On("Verify", "dummy-hash", user.Password).Return(false, false, nil)
+	for i := 0; i < 2; i++ {
+		_, err := uc.LogIn(context.Background(), user)
+		assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	}
+	// The stand-in hash is made once and checked on every attempt.
+	mockPasswordHasher.AssertNumberOfCalls(t, "Hash", 1)
+	mockPasswordHasher.AssertNumberOfCalls(t, "Verify", 2)
+}
+
+func TestLogInLocksOutAfterRepeatedFailures(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	cfg := authConfig
+	cfg.LockoutThreshold = 3
+	cfg.LockoutDuration = time.Minute
+	cfg.MaxLockoutDuration = time.Hour
+	cfg.FailureWindow = time.Hour
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), cfg)
+	user := model.User{Email: "test@example.com", Password: "wrong-password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+
+	mockUserValid.On("UserValidate", mock.Anything).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(model.User{ID: 1, Email: user.Email, Password: string(hash)}, nil)
+	for i := 0; i < 2; i++ {
+		_, err := uc.LogIn(context.Background(), user)
+		assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	}
+	_, err := uc.LogIn(context.Background(), user)
+	var appErr *apperror.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, apperror.KindTooManyRequests, appErr.Kind)
+		assert.InDelta(t, time.Minute, appErr.RetryAfter, float64(time.Second))
+	}
+
+	// Further attempts are refused without checking the password.
+	mockUserRepo.Calls = nil
+	_, err = uc.LogIn(context.Background(), model.User{Email: "Test@example.com", Password: "password"})
+	assert.Equal(t, apperror.KindTooManyRequests, apperror.KindOf(err))
+	mockUserRepo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+}
+
+func TestLogInRateLimitsAttemptsPerAccount(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	cfg := authConfig
+	cfg.LoginBurst = 2
+	cfg.LoginInterval = time.Minute
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), cfg)
+	user := model.User{Email: "nobody@example.com", Password: "password"}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(nil, apperror.NotFound("user not found"))
+	for i := 0; i < 2; i++ {
+		_, err := uc.LogIn(context.Background(), user)
+		assert.ErrorIs(t, err, usecase.ErrInvalidCredentials)
+	}
+	_, err := uc.LogIn(context.Background(), user)
+	var appErr *apperror.Error
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, apperror.KindTooManyRequests, appErr.Kind)
+		assert.Greater(t, appErr.RetryAfter, time.Duration(0))
+	}
+}
+
+func TestForgotPasswordMailsResetLink(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockResetRepo := new(mockPasswordResetRepository)
+	mockMailer := new(mockMailer)
+	cfg := authConfig
+	cfg.PasswordResetURL = "http://localhost:3000/password/reset"
+	cfg.PasswordResetTokenTTL = time.Hour
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), mockResetRepo, new(mockMFARepository), new(mockUserValidator), nil, nil, mockMailer, cfg)
+
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "test@example.com").Return(model.User{ID: 1, Email: "test@example.com"}, nil)
+	mockResetRepo.On("CreateResetToken", mock.AnythingOfType("*model.PasswordResetToken")).Return(nil)
+	mails := make(chan mailer.Message, 1)
+	mockMailer.On("Send", mock.AnythingOfType("mailer.Message")).Return(nil).Run(func(args mock.Arguments) {
+		mails <- args.Get(0).(mailer.Message)
+	})
+	assert.NoError(t, uc.ForgotPassword(context.Background(), "test@example.com"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, uc.Drain(ctx))
+
+	sent := <-mails
+	token := regexp.MustCompile(`\?token=(\S+)`).FindStringSubmatch(sent.Body)
+	if assert.Len(t, token, 2) {
+		mockResetRepo.AssertCalled(t, "CreateResetToken", mock.MatchedBy(func(r *model.PasswordResetToken) bool {
+			return r.UserID == 1 && r.TokenHash != "" && r.TokenHash != token[1]
+		}))
+	}
+}
+
+func TestForgotPasswordHidesMailerErrors(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockResetRepo := new(mockPasswordResetRepository)
+	mockMailer := new(mockMailer)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), mockResetRepo, new(mockMFARepository), new(mockUserValidator), nil, nil, mockMailer, authConfig)
+
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "test@example.com").Return(model.User{ID: 1, Email: "test@example.com"}, nil)
+	mockResetRepo.On("CreateResetToken", mock.AnythingOfType("*model.PasswordResetToken")).Return(nil)
+	mockMailer.On("Send", mock.AnythingOfType("mailer.Message")).Return(errors.New("smtp unavailable"))
+	assert.NoError(t, uc.ForgotPassword(context.Background(), "test@example.com"))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, uc.Drain(ctx))
+	mockMailer.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestForgotPasswordIsSilentForUnknownEmail(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockMailer := new(mockMailer)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, mockMailer, authConfig)
+
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), "nobody@example.com").Return(nil, apperror.NotFound("user not found"))
+	assert.NoError(t, uc.ForgotPassword(context.Background(), "nobody@example.com"))
+	mockMailer.AssertNotCalled(t, "Send", mock.Anything)
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	mockResetRepo := new(mockPasswordResetRepository)
+	mockUserValid := new(mockUserValidator)
+	mockPasswordHasher := new(mockPasswordHasher)
+	revocationRepo := repository.NewMemoryRevocationRepository()
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, revocationRepo, repository.NewMemoryRateLimitRepository(), mockResetRepo, new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	mockUserValid.On("PasswordValidate", "new-password").Return(nil)
+	mockPasswordHasher.On("Hash", "new-password").Return("new-hash", nil)
+	mockResetRepo.On("ResetPassword", mock.AnythingOfType("*model.User"), mock.AnythingOfType("string"), "new-hash").Return(model.User{ID: 1, Email: "test@example.com"}, nil)
+	mockSessionRepo.On("RevokeUserSessions", uint64(1)).Return(nil)
+	err := uc.ResetPassword(context.Background(), model.PasswordReset{Token: "reset-token", Password: "new-password"})
+	assert.NoError(t, err)
+	mockResetRepo.AssertNotCalled(t, "ResetPassword", mock.Anything, "reset-token", mock.Anything)
+	mockSessionRepo.AssertCalled(t, "RevokeUserSessions", uint64(1))
+	revoked, _ := revocationRepo.IsRevoked(context.Background(), "old", 1, issuedAt)
+	assert.True(t, revoked)
+}
+
+func TestResetPasswordRejectsUnknownToken(t *testing.T) {
+	mockResetRepo := new(mockPasswordResetRepository)
+	mockUserValid := new(mockUserValidator)
+	mockPasswordHasher := new(mockPasswordHasher)
+	uc := usecase.NewUserUseCase(new(mockUserRepository), new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), mockResetRepo, new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
+
+	mockUserValid.On("PasswordValidate", "new-password").Return(nil)
+	mockPasswordHasher.On("Hash", "new-password").Return("new-hash", nil)
+	mockResetRepo.On("ResetPassword", mock.AnythingOfType("*model.User"), mock.AnythingOfType("string"), "new-hash").Return(nil, apperror.NotFound("reset token not found"))
+	err := uc.ResetPassword(context.Background(), model.PasswordReset{Token: "used-token", Password: "new-password"})
+	assert.ErrorIs(t, err, usecase.ErrInvalidResetToken)
+}
+
+func TestUpdateEmailWaitsForVerification(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	mockMailer := new(mockMailer)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, mockMailer, authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	storedUser := model.User{ID: 1, Email: "old@example.com", Password: string(hash), EmailVerifiedAt: &verifiedAt}
+
+	mockUserValid.On("EmailValidate", "new@example.com").Return(nil)
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(storedUser, nil)
+	pending := storedUser
+	pending.PendingEmail = "new@example.com"
+	mockUserRepo.On("SetPendingEmail", mock.AnythingOfType("*model.User"), uint64(1), "new@example.com").Return(pending, nil)
+	var sent mailer.Message
+	mockMailer.On("Send", mock.AnythingOfType("mailer.Message")).Return(nil).Run(func(args mock.Arguments) {
+		sent = args.Get(0).(mailer.Message)
+	})
+	res, err := uc.UpdateEmail(context.Background(), 1, model.EmailChange{Email: "new@example.com", Password: "password"})
+	assert.NoError(t, err)
+	assert.Equal(t, "old@example.com", res.Email)
+	assert.Equal(t, "new@example.com", res.PendingEmail)
+	assert.Equal(t, &verifiedAt, res.EmailVerifiedAt)
+	assert.Equal(t, "new@example.com", sent.To)
+
+	// The link in the email is what moves the account over.
+	token := regexp.MustCompile(`\?token=(\S+)`).FindStringSubmatch(sent.Body)
+	if assert.Len(t, token, 2) {
+		mockUserRepo.On("VerifyEmail", uint64(1), "new@example.com").Return(nil)
+		unescaped, _ := url.QueryUnescape(token[1])
+		assert.NoError(t, uc.VerifyEmail(context.Background(), unescaped))
+		mockUserRepo.AssertCalled(t, "VerifyEmail", uint64(1), "new@example.com")
+	}
+}
+
+func TestChangePasswordRejectsWrongCurrentPassword(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockUserValid := new(mockUserValidator)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, nil, nil, new(mockMailer), authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+
+	mockUserValid.On("PasswordValidate", "new-password").Return(nil)
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash)}, nil)
+	_, err := uc.ChangePassword(context.Background(), 1, model.PasswordChange{CurrentPassword: "wrong-password", NewPassword: "new-password"})
+	assert.ErrorIs(t, err, usecase.ErrIncorrectPassword)
+	mockUserRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+}
+
+func TestChangePasswordStartsFreshSession(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	mockUserValid := new(mockUserValidator)
+	mockPasswordHasher := new(mockPasswordHasher)
+	revocationRepo := repository.NewMemoryRevocationRepository()
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, revocationRepo, repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), mockUserValid, mockPasswordHasher, nil, new(mockMailer), authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	mockUserValid.On("PasswordValidate", "new-password").Return(nil)
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash)}, nil)
+	mockPasswordHasher.On("Verify", string(hash), "password").Return(true, false, nil)
+	mockPasswordHasher.On("Hash", "new-password").Return("new-hash", nil)
+	mockUserRepo.On("UpdatePassword", uint64(1), "new-hash").Return(nil)
+	mockSessionRepo.On("RevokeUserSessions", uint64(1)).Return(nil)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	tokens, err := uc.ChangePassword(context.Background(), 1, model.PasswordChange{CurrentPassword: "password", NewPassword: "new-password"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	revoked, _ := revocationRepo.IsRevoked(context.Background(), "old", 1, issuedAt)
+	assert.True(t, revoked)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	revocationRepo := repository.NewMemoryRevocationRepository()
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, revocationRepo, repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	issuedAt := time.Now().Add(-time.Minute)
+
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash)}, nil)
+	mockUserRepo.On("CheckDeletable", uint64(1)).Return(nil)
+	mockUserRepo.On("DeleteUser", uint64(1)).Return(nil)
+	mockSessionRepo.On("RevokeUserSessions", uint64(1)).Return(nil)
+	assert.ErrorIs(t, uc.DeleteAccount(context.Background(), 1, "wrong-password"), usecase.ErrIncorrectPassword)
+	mockUserRepo.AssertNotCalled(t, "DeleteUser", mock.Anything)
+	mockSessionRepo.AssertNotCalled(t, "RevokeUserSessions", mock.Anything)
+	assert.NoError(t, uc.DeleteAccount(context.Background(), 1, "password"))
+	mockUserRepo.AssertCalled(t, "DeleteUser", uint64(1))
+	// Access tokens on the user's other devices stop working too.
+	revoked, _ := revocationRepo.IsRevoked(context.Background(), "other-device", 1, issuedAt)
+	assert.True(t, revoked)
+}
+
+func TestDeleteAccountRefusesWhileLastOwnerOfSharedProject(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	lastOwner := apperror.ConflictWith("you are the last owner of projects shared with others; hand them over or delete them first", map[string]interface{}{"project_ids": []uint64{3}})
+
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash)}, nil)
+	mockUserRepo.On("CheckDeletable", uint64(1)).Return(lastOwner)
+	err := uc.DeleteAccount(context.Background(), 1, "password")
+	assert.Equal(t, apperror.KindConflict, apperror.KindOf(err))
+	mockUserRepo.AssertNotCalled(t, "DeleteUser", mock.Anything)
+	// The user stays signed in to sort out their projects.
+	mockSessionRepo.AssertNotCalled(t, "RevokeUserSessions", mock.Anything)
+}
+
+func TestLogInWithTOTPRequiresSecondFactor(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockSessionRepo := new(mockSessionRepository)
+	mockMFARepo := new(mockMFARepository)
+	mockUserValid := new(mockUserValidator)
+	uc := usecase.NewUserUseCase(mockUserRepo, mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), mockMFARepo, mockUserValid, nil, nil, new(mockMailer), authConfig)
+	user := model.User{Email: "test@example.com", Password: "password"}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(user.Password), 10)
+	secret, _ := totp.GenerateSecret()
+	storedUser := model.User{ID: 1, Email: user.Email, Password: string(hash), EmailVerifiedAt: &verifiedAt, TOTPSecret: secret, TOTPEnabledAt: &verifiedAt}
+
+	mockUserValid.On("UserValidate", user).Return(nil)
+	mockUserRepo.On("GetUserByEmail", mock.AnythingOfType("*model.User"), user.Email).Return(storedUser, nil)
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(storedUser, nil)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	result, err := uc.LogIn(context.Background(), user)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Tokens.AccessToken)
+	mockSessionRepo.AssertNotCalled(t, "CreateSession", mock.Anything)
+	if !assert.NotNil(t, result.Challenge) {
+		return
+	}
+
+	if code, _ := totp.Code(secret, totp.Step(time.Now())); code == "000000" {
+		t.Skip("random secret produced the guessed code")
+	}
+	mockMFARepo.On("UseRecoveryCode", uint64(1), mock.Anything).Return(apperror.NotFound("recovery code not found"))
+	_, err = uc.VerifyMFA(context.Background(), model.MFAVerification{MFAToken: result.Challenge.MFAToken, Code: "000000"})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFACode)
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+	mockMFARepo.On("UseTOTPStep", uint64(1), step).Return(nil).Once()
+	tokens, err := uc.VerifyMFA(context.Background(), model.MFAVerification{MFAToken: result.Challenge.MFAToken, Code: code})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	mockSessionRepo.AssertCalled(t, "CreateSession", mock.AnythingOfType("*model.Session"))
+
+	// A code is good for one login only.
+	mockMFARepo.On("UseTOTPStep", uint64(1), step).Return(apperror.NotFound("totp code already used"))
+	_, err = uc.VerifyMFA(context.Background(), model.MFAVerification{MFAToken: result.Challenge.MFAToken, Code: code})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFACode)
+}
+
+func TestVerifyMFARejectsAccessToken(t *testing.T) {
+	mockSessionRepo := new(mockSessionRepository)
+	uc := usecase.NewUserUseCase(new(mockUserRepository), mockSessionRepo, repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), new(mockMFARepository), new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	mockSessionRepo.On("CreateSession", mock.AnythingOfType("*model.Session")).Return(nil)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1, "sub": "1", "exp": time.Now().Add(time.Minute).Unix()})
+	accessToken, _ := token.SignedString([]byte(authConfig.Secret.Value()))
+
+	_, err := uc.VerifyMFA(context.Background(), model.MFAVerification{MFAToken: accessToken, Code: "123456"})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFAToken)
+}
+
+func TestConfirmTOTPReturnsRecoveryCodes(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockMFARepo := new(mockMFARepository)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), mockMFARepo, new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	secret, _ := totp.GenerateSecret()
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", TOTPSecret: secret}, nil)
+	mockMFARepo.On("EnableTOTP", uint64(1), step, mock.AnythingOfType("[]string")).Return(nil)
+	codes, err := uc.ConfirmTOTP(context.Background(), 1, code)
+	assert.NoError(t, err)
+	assert.Len(t, codes.Codes, 10)
+	hashes := mockMFARepo.Calls[0].Arguments.Get(2).([]string)
+	assert.Len(t, hashes, 10)
+	assert.NotContains(t, hashes, codes.Codes[0])
+}
+
+func TestDisableTOTPRequiresCode(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockMFARepo := new(mockMFARepository)
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), mockMFARepo, new(mockUserValidator), nil, nil, new(mockMailer), authConfig)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	secret, _ := totp.GenerateSecret()
+
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash), TOTPSecret: secret, TOTPEnabledAt: &verifiedAt}, nil)
+	mockMFARepo.On("UseRecoveryCode", uint64(1), mock.Anything).Return(apperror.NotFound("recovery code not found")).Once()
+	mockMFARepo.On("UseRecoveryCode", uint64(1), mock.Anything).Return(nil)
+	mockMFARepo.On("DisableTOTP", uint64(1)).Return(nil)
+	err := uc.DisableTOTP(context.Background(), 1, model.MFAConfirmation{Password: "password", Code: "wrong-code"})
+	assert.ErrorIs(t, err, usecase.ErrInvalidMFACode)
+	mockMFARepo.AssertNotCalled(t, "DisableTOTP", mock.Anything)
+
+	assert.NoError(t, uc.DisableTOTP(context.Background(), 1, model.MFAConfirmation{Password: "password", Code: "abcde-fghij"}))
+	mockMFARepo.AssertCalled(t, "DisableTOTP", uint64(1))
+}
+
+func TestDisableTOTPLocksOutAfterRepeatedWrongCodes(t *testing.T) {
+	mockUserRepo := new(mockUserRepository)
+	mockMFARepo := new(mockMFARepository)
+	cfg := authConfig
+	cfg.LockoutThreshold = 3
+	cfg.LockoutDuration = time.Minute
+	cfg.MaxLockoutDuration = time.Hour
+	cfg.FailureWindow = time.Hour
+	uc := usecase.NewUserUseCase(mockUserRepo, new(mockSessionRepository), repository.NewMemoryRevocationRepository(), repository.NewMemoryRateLimitRepository(), new(mockPasswordResetRepository), mockMFARepo, new(mockUserValidator), nil, nil, new(mockMailer), cfg)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), 10)
+	secret, _ := totp.GenerateSecret()
+	confirmation := model.MFAConfirmation{Password: "password", Code: "wrong-code"}
+
+	mockUserRepo.On("GetUserByID", mock.AnythingOfType("*model.User"), uint64(1)).Return(model.User{ID: 1, Email: "test@example.com", Password: string(hash), TOTPSecret: secret, TOTPEnabledAt: &verifiedAt}, nil)
+	mockMFARepo.On("UseRecoveryCode", uint64(1), mock.Anything).Return(apperror.NotFound("recovery code not found"))
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, uc.DisableTOTP(context.Background(), 1, confirmation), usecase.ErrInvalidMFACode)
+	}
+	// The correct password doesn't forgive the wrong codes.
+	err := uc.DisableTOTP(context.Background(), 1, confirmation)
+	assert.Equal(t, apperror.KindTooManyRequests, apperror.KindOf(err))
+	_, err = uc.RegenerateRecoveryCodes(context.Background(), 1, confirmation)
+	assert.Equal(t, apperror.KindTooManyRequests, apperror.KindOf(err))
+	mockMFARepo.AssertNotCalled(t, "DisableTOTP", mock.Anything)
+}
@@ -0,0 +1,22 @@
+package validator
+
+import (
+	"errors"
+	"go-rest-api/apperror"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// toAppError turns ozzo-validation field errors into an apperror validation
+// error keyed by the fields' JSON names. Other errors are returned unchanged.
+func toAppError(err error) error {
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	fields := map[string]string{}
+	for name, fieldErr := range errs {
+		fields[name] = fieldErr.Error()
+	}
+	return apperror.Validation(err.Error(), fields)
+}
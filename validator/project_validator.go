@@ -0,0 +1,43 @@
+package validator
+
+import (
+	"go-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IProjectValidator interface {
+	ProjectValidate(project model.Project) error
+	ProjectDeletionValidate(deletion model.ProjectDeletion) error
+	ProjectInvitationValidate(invitation model.ProjectInvitation) error
+}
+
+type projectValidator struct{}
+
+func NewProjectValidator() IProjectValidator {
+	return &projectValidator{}
+}
+
+func (pv *projectValidator) ProjectValidate(project model.Project) error {
+	return toAppError(validation.ValidateStruct(&project,
+		validation.Field(&project.Name, validation.Required.Error("name is required"), validation.Length(1, 100).Error("limited max 100 characters")),
+		validation.Field(&project.Description, validation.Length(0, 2000).Error("limited max 2000 characters")),
+	))
+}
+
+func (pv *projectValidator) ProjectDeletionValidate(deletion model.ProjectDeletion) error {
+	return toAppError(validation.ValidateStruct(&deletion,
+		validation.Field(&deletion.Tasks, validation.Required.Error("tasks is required"),
+			validation.In(model.ProjectTasksMove, model.ProjectTasksDelete).Error("tasks must be move or delete")),
+		validation.Field(&deletion.MoveTo, validation.When(deletion.Tasks == model.ProjectTasksDelete,
+			validation.Empty.Error("move_to can't be used when tasks are deleted"))),
+	))
+}
+
+func (pv *projectValidator) ProjectInvitationValidate(invitation model.ProjectInvitation) error {
+	return toAppError(validation.ValidateStruct(&invitation,
+		validation.Field(&invitation.Email, validation.Required.Error("email is required"), validation.Length(1, 30).Error("limited max 30 characters")),
+		validation.Field(&invitation.Role, validation.Required.Error("role is required"),
+			validation.In(model.ProjectRoleOwner, model.ProjectRoleEditor, model.ProjectRoleViewer).Error("role must be owner, editor or viewer")),
+	))
+}
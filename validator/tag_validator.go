@@ -0,0 +1,36 @@
+package validator
+
+import (
+	"go-rest-api/model"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// maxTaskTags caps how many tags a task can carry or a query can filter by.
+const maxTaskTags = 20
+
+var tagNamePattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+( [\p{L}\p{N}_-]+)*$`)
+
+// tagNameRules are shared by tags, the tags set on tasks and tag filters.
+var tagNameRules = []validation.Rule{
+	validation.Required.Error("tag name is required"),
+	validation.Length(1, 30).Error("limited max 30 characters"),
+	validation.Match(tagNamePattern).Error("tag names may only contain letters, digits, -, _ and single spaces"),
+}
+
+type ITagValidator interface {
+	TagValidate(tag model.Tag) error
+}
+
+type tagValidator struct{}
+
+func NewTagValidator() ITagValidator {
+	return &tagValidator{}
+}
+
+func (tv *tagValidator) TagValidate(tag model.Tag) error {
+	return toAppError(validation.ValidateStruct(&tag,
+		validation.Field(&tag.Name, tagNameRules...),
+	))
+}
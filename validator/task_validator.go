@@ -1,13 +1,16 @@
 package validator
 
 import (
+	"errors"
 	"go-rest-api/model"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
 type ITaskValidator interface {
 	TaskValidate(task model.Task) error
+	TaskQueryValidate(query model.TaskQuery) error
 }
 
 type taskValidator struct{}
@@ -16,7 +19,37 @@ func NewTaskValidator() ITaskValidator {
 	return &taskValidator{}
 }
 func (tv *taskValidator) TaskValidate(task model.Task) error {
-	return validation.ValidateStruct(&task,
+	return toAppError(validation.ValidateStruct(&task,
 		validation.Field(&task.Title, validation.Required.Error("title is required"), validation.Length(1, 30).Error("limited max 10 characters")),
-	)
+		validation.Field(&task.Description, validation.Length(0, 2000).Error("limited max 2000 characters")),
+		validation.Field(&task.Status, validation.Required.Error("status is required"),
+			validation.In(model.TaskStatusTodo, model.TaskStatusInProgress, model.TaskStatusDone, model.TaskStatusArchived).Error("status must be one of todo, in_progress, done, archived")),
+		validation.Field(&task.Priority, validation.Required.Error("priority is required"),
+			validation.In(model.TaskPriorityLow, model.TaskPriorityMedium, model.TaskPriorityHigh, model.TaskPriorityUrgent).Error("priority must be one of low, medium, high, urgent")),
+		validation.Field(&task.TagNames, validation.Length(0, maxTaskTags).Error("limited max 20 tags"), validation.Each(tagNameRules...)),
+	))
+}
+
+func (tv *taskValidator) TaskQueryValidate(query model.TaskQuery) error {
+	return toAppError(validation.ValidateStruct(&query,
+		validation.Field(&query.Limit, validation.Min(1).Error("limit must be at least 1"), validation.Max(100).Error("limit must be at most 100")),
+		validation.Field(&query.Sort, validation.In("created_at", "updated_at", "title", "id").Error("sort must be one of created_at, updated_at, title, id")),
+		validation.Field(&query.Order, validation.In("asc", "desc").Error("order must be asc or desc")),
+		validation.Field(&query.CreatedTo, validation.By(notBefore(query.CreatedFrom, "created_to must not be before created_from"))),
+		validation.Field(&query.UpdatedTo, validation.By(notBefore(query.UpdatedFrom, "updated_to must not be before updated_from"))),
+		validation.Field(&query.Tags, validation.Length(0, maxTaskTags).Error("limited max 20 tags"), validation.Each(tagNameRules...)),
+		validation.Field(&query.Embed, validation.In(model.TaskEmbedSubtasks).Error("embed must be subtasks")),
+		validation.Field(&query.TagMatch, validation.In(model.TagMatchAny, model.TagMatchAll).Error("tag_match must be any or all")),
+	))
+}
+
+// notBefore checks that a time.Time field does not precede from when both are set.
+func notBefore(from time.Time, message string) validation.RuleFunc {
+	return func(value interface{}) error {
+		to, _ := value.(time.Time)
+		if !from.IsZero() && !to.IsZero() && to.Before(from) {
+			return errors.New(message)
+		}
+		return nil
+	}
 }
@@ -8,6 +8,8 @@ import (
 
 type IUserValidator interface {
 	UserValidate(user model.User) error
+	EmailValidate(email string) error
+	PasswordValidate(password string) error
 }
 
 type userValidator struct{}
@@ -17,8 +19,20 @@ func NewUserValidator() IUserValidator {
 }
 
 func (uv *userValidator) UserValidate(user model.User) error {
-	return validation.ValidateStruct(&user,
+	return toAppError(validation.ValidateStruct(&user,
 		validation.Field(&user.Email, validation.Required.Error("email is required"), validation.Length(1, 30).Error("limited max 10 characters")),
 		validation.Field(&user.Password, validation.Required.Error("password is required"), validation.Length(6, 30).Error("limited min 6 max 10 characters")),
-	)
+	))
+}
+
+func (uv *userValidator) EmailValidate(email string) error {
+	return toAppError(validation.Errors{
+		"email": validation.Validate(email, validation.Required.Error("email is required"), validation.Length(1, 30).Error("limited max 30 characters")),
+	}.Filter())
+}
+
+func (uv *userValidator) PasswordValidate(password string) error {
+	return toAppError(validation.Errors{
+		"password": validation.Validate(password, validation.Required.Error("password is required"), validation.Length(6, 30).Error("limited min 6 max 30 characters")),
+	}.Filter())
 }